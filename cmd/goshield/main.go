@@ -0,0 +1,817 @@
+// GoShield - Advanced Go Source Code Obfuscator
+// Copyright (c) 2024 - MIT License
+//
+// A powerful tool to protect your Go source code through multi-layer obfuscation:
+// - Identifier renaming with Unicode lookalikes
+// - String literal encryption
+// - Integer transformation
+// - JavaScript/embedded code obfuscation
+// - Import aliasing
+// - Comment removal
+//
+// Usage:
+//   goshield -i input.go -o output.go [options]
+//   goshield -deobf -map-in map.json < trace.txt
+//   goshield -i a.go,b.go -o ./out [options]
+//   goshield -i a.go -i b.go -o combined.go [options]
+//   goshield -dir ./pkg -o ./out [options]
+//
+// Options:
+//   -i              Input file path, repeatable or comma-separated (required unless -dir is used)
+//   -o              Output file path, - for stdout (output directory with several inputs or -dir,
+//                   unless it names one .go file to merge the inputs into)
+//   -dir            Input directory (obfuscates every .go file with a shared rename map)
+//   -obfuscate-generated  Also obfuscate generated files (copied through by default)
+//   -include-tests  Also obfuscate _test.go files in -dir mode
+//   -force          Process inputs that would normally be skipped (generated files, earlier output)
+//   -max-file-size  Refuse input files larger than this many MB (default 10, 0 = no limit)
+//   -deobf          Restore original names in stdin text using -map-in
+//   -watermark      Embed an encoded text in the output to trace leaked copies
+//   -extract-watermark  Print the watermarks found in obfuscated files
+//   -skip-typecheck Obfuscate input that doesn't type-check, using what resolves
+//   -no-type-check  Skip the go/types check that keeps interface method names
+//   -no-reflect-names  Rename names that FieldByName/MethodByName look up
+//   -j, -jobs       Files encoded and written in parallel (default GOMAXPROCS)
+//   -dry-run        Run every pass and print statistics, but write nothing
+//   -score          Rate the result from 0 to 100 with a per-category breakdown
+//   -json           Print the summary as JSON on stdout
+//   -report         Write a JSON summary with counts, elapsed time and paths
+//   -version        Print the version and the commit goshield was built from
+//   -watch          Obfuscate again whenever an input changes (one status line per run)
+//   -config         YAML or JSON file setting options by flag name
+//   -seed           Seed for reproducible output
+//   -seed-file      Read the seed from a file
+//   -salt           Mix a text and the input paths into the seed
+//   -map-in         JSON name map from an earlier run to reuse and extend
+//   -map-out        Write the resulting name map to a JSON file
+//   -no-ints        Disable integer obfuscation
+//   -int-min        Smallest integer literal to obfuscate (default 11)
+//   -int-max        Largest integer literal to obfuscate (default 100000)
+//   -no-strings     Disable string obfuscation
+//   -no-vars        Disable variable name obfuscation
+//   -no-functions   Disable function name obfuscation
+//   -no-imports     Disable import alias obfuscation
+//   -keep-imports   Comma-separated import paths that keep their local name
+//   -no-labels      Disable label obfuscation
+//   -no-consts      Keep package-level const declarations const
+//   -name-len       Length of generated identifier names (default 20)
+//   -string-mode    String encoding: concat (default), xor, base64 or table (runtime decoders)
+//   -poly           Draw the encoding of each string and integer at random
+//   -switch-to-if   Rewrite switch statements as if/else chains
+//   -split          Spread each output file over N files of the package
+//   -no-backticks   Disable embedded code (backtick string) obfuscation
+//   -obfuscate-urls Also obfuscate strings containing ://
+//   -keep-strings   Regular expression of string literals to leave untouched
+//   -min-string-len Minimum string literal length to obfuscate (default 3)
+//   -min-backtick-len  Minimum backtick string length to obfuscate (default 20)
+//   -code-markers   Comma-separated substrings that mark a backtick string as code
+//   -only-funcs     Only obfuscate strings/integers inside these functions
+//   -keep-exported  Keep exported identifiers (public API of a library)
+//   -keep-exported-methods  Keep exported method names, rename the rest
+//   -only-unexported  Rename only unexported identifiers (same as -keep-exported)
+//   -only-exported  Rename only exported identifiers
+//   -func-pattern   Rename only functions and methods whose name matches this regular expression
+//   -type-pattern   Rename only types whose name matches this regular expression
+//   -fields         Obfuscate struct field names, literal keys and selectors
+//   -field-tags     Tag keys that keep renamed exported fields' original names
+//   -keep-exported-fields  With -fields, rename only unexported fields
+//   -rename-package Obfuscate the package name (never main)
+//   -skip-templates Leave template strings ({{ ... }}) untouched
+//   -split-templates Obfuscate template strings but keep their {{ ... }} actions
+//   -keep-comments  Keep every comment, doc comments included
+//   -garble-comments  Scramble comment text in place to preserve line numbers
+//   -keep-header    Keep the leading comment block (license header)
+//   -expire         Exit once this date has passed (trial builds); -expire-message sets the text
+//   -tamper-check   Exit (or call -tamper-handler) if the first file's string constants change
+//   -integrity      Exit (or call -tamper-handler) if the string constants between //goshield:integrity markers change
+//   -minify         Minify output (remove newlines, single line)
+//   -v              Verbose output
+//   -log-json       Write log messages as JSON objects, one per line
+//   -quiet          Print errors only (with -watch, failed runs only)
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rafaelwdornelas/goshield"
+)
+
+// =============================================================================
+// CONFIGURATION
+// =============================================================================
+
+var (
+	opts       goshield.Options
+	jsonOut    = flag.Bool("json", false, "Print the summary as JSON on stdout")
+	extractWM  = flag.Bool("extract-watermark", false, "Print the -watermark texts found in the given obfuscated files (-i, -dir or arguments)")
+	deobf      = flag.Bool("deobf", false, "Read text (e.g. a stack trace) from stdin and restore the original names using -map-in")
+	reportFile = flag.String("report", "", "Write a JSON summary (counts, elapsed time, paths) to this file")
+	showVer    = flag.Bool("version", false, "Print the goshield version and the commit it was built from")
+	configFile = flag.String("config", "", "YAML or JSON file setting options by flag name (command-line flags win)")
+	watch      = flag.Bool("watch", false, "Keep running and obfuscate again whenever an input changes")
+)
+
+// listFlag is a string flag that may be repeated, joining the values with
+// commas as if they had been given as one list.
+type listFlag struct{ list *string }
+
+func (f listFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	return *f.list
+}
+
+func (f listFlag) Set(value string) error {
+	if *f.list != "" && value != "" {
+		value = *f.list + "," + value
+	}
+	*f.list = value
+	return nil
+}
+
+func init() {
+	flag.Usage = printUsage
+	defaults := goshield.DefaultOptions()
+	flag.Var(listFlag{&opts.Input}, "i", "Input Go file path, repeat or comma-separate for several files (merged when -o names one .go file)")
+	flag.StringVar(&opts.Output, "o", "", "Output Go file path, - for stdout (output directory for several files, unless it names one .go file to merge them into)")
+	flag.StringVar(&opts.Dir, "dir", "", "Input directory (all .go files share one rename map, -o is the output directory)")
+	flag.StringVar(&opts.Seed, "seed", "", "Seed for reproducible obfuscation (random seeds are printed for reuse)")
+	flag.StringVar(&opts.SeedFile, "seed-file", "", "Read the seed from a file")
+	flag.StringVar(&opts.Salt, "salt", "", "Mix this text and the input paths into the seed, so identical files elsewhere obfuscate differently")
+	flag.StringVar(&opts.MapIn, "map-in", "", "JSON name map from an earlier run to reuse and extend")
+	flag.StringVar(&opts.MapOut, "map-out", "", "Write the name map (loaded and new names) to this JSON file")
+	flag.BoolVar(&opts.Verbose, "v", false, "Verbose output")
+	flag.BoolVar(&logger.JSON, "log-json", false, "Write log messages as JSON objects, one per line, with time, level, msg and fields")
+	flag.BoolVar(&logger.Quiet, "quiet", false, "Print errors only; with -watch, only the runs that failed")
+
+	flag.BoolVar(&opts.NoInts, "no-ints", false, "Disable integer obfuscation")
+	flag.Int64Var(&opts.IntMin, "int-min", defaults.IntMin, "Smallest integer literal to obfuscate")
+	flag.Int64Var(&opts.IntMax, "int-max", defaults.IntMax, "Largest integer literal to obfuscate")
+	flag.BoolVar(&opts.NoStrings, "no-strings", false, "Disable string obfuscation")
+	flag.BoolVar(&opts.NoVars, "no-vars", false, "Disable variable obfuscation")
+	flag.BoolVar(&opts.NoFunctions, "no-functions", false, "Disable function obfuscation")
+	flag.BoolVar(&opts.NoImports, "no-imports", false, "Disable import obfuscation")
+	flag.StringVar(&opts.KeepImports, "keep-imports", "", "Comma-separated import paths that keep their local name (e.g. context,testing)")
+	flag.BoolVar(&opts.NoLabels, "no-labels", false, "Disable label obfuscation")
+	flag.BoolVar(&opts.NoConsts, "no-consts", false, "Keep package-level consts instead of turning them into vars (names and values are still obfuscated)")
+	flag.BoolVar(&opts.SwitchToIf, "switch-to-if", false, "Rewrite switch statements as if/else chains")
+	flag.IntVar(&opts.Split, "split", 0, "Spread the declarations of each output file over this many files of the package")
+	flag.BoolVar(&opts.Minify, "minify", false, "Minify output (remove newlines, single line)")
+	flag.BoolVar(&opts.KeepHeader, "keep-header", false, "Keep the leading comment block (license header) of each file")
+	flag.StringVar(&opts.Watermark, "watermark", "", "Embed this text, encoded, in the first output file to trace leaked copies")
+	flag.BoolVar(&opts.TamperCheck, "tamper-check", false, "Inject an init check that hashes the first file's string constants and exits if they were modified")
+	flag.BoolVar(&opts.Integrity, "integrity", false, "Inject an init check that hashes the string constants between //goshield:integrity-begin and //goshield:integrity-end comments and exits if they were modified")
+	flag.StringVar(&opts.Expire, "expire", "", "Make the program exit once this date (2006-01-02, end of day UTC) or RFC 3339 time has passed")
+	flag.StringVar(&opts.ExpireMessage, "expire-message", defaults.ExpireMessage, "Message printed on stderr by the -expire check")
+	flag.StringVar(&opts.TamperHandler, "tamper-handler", "", "Package-level func() called instead of exiting when -tamper-check or -integrity fails")
+	flag.BoolVar(&opts.KeepComments, "keep-comments", false, "Keep every comment, doc comments included (cannot be combined with -minify)")
+	flag.BoolVar(&opts.GarbleComments, "garble-comments", false, "Replace comment text with random characters instead of removing it, so line numbers stay those of the input")
+	flag.BoolVar(&opts.Poly, "poly", false, "Draw the encoding of each string and integer at random (character codes, decoders, hoisting, nested transforms)")
+	flag.StringVar(&opts.StringMode, "string-mode", defaults.StringMode, "String encoding: concat, xor, base64 or table (runtime decoders)")
+	flag.IntVar(&opts.NameLen, "name-len", defaults.NameLen, "Length of generated identifier names")
+
+	flag.BoolVar(&opts.NoBackticks, "no-backticks", false, "Disable embedded code (backtick string) obfuscation")
+	flag.BoolVar(&opts.ObfuscateURLs, "obfuscate-urls", false, "Also obfuscate strings containing :// (left readable by default)")
+	flag.StringVar(&opts.KeepStrings, "keep-strings", "", "Regular expression; string literals it matches are left untouched")
+	flag.IntVar(&opts.MinStringLen, "min-string-len", defaults.MinStringLen, "Minimum length of a string literal to be obfuscated")
+	flag.IntVar(&opts.MinBacktickLen, "min-backtick-len", defaults.MinBacktickLen, "Minimum length of a backtick string to be obfuscated")
+	flag.IntVar(&opts.MinBacktickLen, "backtick-min-len", defaults.MinBacktickLen, "Alias for -min-backtick-len")
+	flag.StringVar(&opts.CodeMarkers, "code-markers", defaults.CodeMarkers, "Comma-separated substrings marking a backtick string as code (spaces are significant)")
+
+	flag.StringVar(&opts.OnlyFuncs, "only-funcs", "", "Comma-separated functions whose bodies get string/integer obfuscation (the rest stays readable)")
+	flag.BoolVar(&opts.KeepExported, "keep-exported", false, "Keep every identifier starting with an uppercase letter (obfuscate a library without breaking its API)")
+	flag.BoolVar(&opts.KeepExportedMethods, "keep-exported-methods", false, "Keep the names of exported methods; unexported methods and everything else are still renamed")
+	flag.BoolVar(&opts.OnlyUnexported, "only-unexported", false, "Rename only unexported identifiers (same as -keep-exported)")
+	flag.BoolVar(&opts.OnlyExported, "only-exported", false, "Rename only exported identifiers (the public surface)")
+	flag.StringVar(&opts.FuncPattern, "func-pattern", "", "Regular expression; only functions and methods whose name it matches are renamed")
+	flag.StringVar(&opts.TypePattern, "type-pattern", "", "Regular expression; only types whose name it matches are renamed")
+	flag.BoolVar(&opts.Fields, "fields", false, "Obfuscate struct field names (breaks untagged JSON/XML/GOB serialization)")
+	flag.BoolVar(&opts.KeepExportedFields, "keep-exported-fields", false, "With -fields, rename only unexported fields; exported ones keep the names encoders and reflection see")
+	flag.StringVar(&opts.FieldTags, "field-tags", defaults.FieldTags, "Comma-separated struct tag keys -fields fills in with the original name of renamed exported fields")
+	flag.BoolVar(&opts.RenamePackage, "rename-package", false, "Obfuscate the package name (package main is never renamed)")
+	flag.BoolVar(&opts.SkipTemplates, "skip-templates", false, "Leave strings containing {{ }} template actions untouched")
+	flag.BoolVar(&opts.SplitTemplates, "split-templates", false, "Obfuscate only the text around {{ }} template actions, keeping the actions readable")
+
+	flag.BoolVar(&opts.ObfuscateGenerated, "obfuscate-generated", false, "Obfuscate generated files instead of copying them through")
+	flag.BoolVar(&opts.IncludeTests, "include-tests", false, "Also obfuscate _test.go files found by -dir (test functions keep their names)")
+	flag.BoolVar(&opts.NoReflectNames, "no-reflect-names", false, "Rename fields and methods even when FieldByName/MethodByName look them up by a string literal")
+	flag.BoolVar(&opts.SkipTypeCheck, "skip-typecheck", false, "Obfuscate input that doesn't type-check (fragments, one file of a package), using whatever resolves")
+	flag.BoolVar(&opts.NoTypeCheck, "no-type-check", false, "Skip type checking; only reserved method names keep their spelling (faster, may break interface implementations)")
+	flag.IntVar(&opts.Jobs, "j", 0, "Files encoded and written in parallel in the final stage (0 = GOMAXPROCS)")
+	flag.IntVar(&opts.Jobs, "jobs", 0, "Alias for -j")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "Run every pass and print statistics, but write nothing")
+	flag.BoolVar(&opts.Score, "score", false, "Rate the result from 0 to 100 with a per-category breakdown")
+	flag.BoolVar(&opts.Force, "force", false, "Process inputs GoShield would normally skip: generated files (implies -obfuscate-generated) and its own output")
+	flag.IntVar(&opts.MaxFileSize, "max-file-size", defaults.MaxFileSize, "Refuse input files larger than this many MB before parsing them (0 = no limit)")
+}
+
+// =============================================================================
+// GLOBAL STATE
+// =============================================================================
+
+// version is set at build time:
+//
+//	go build -ldflags "-X main.version=1.2.0" ./cmd/goshield
+var version = "1.0"
+
+// logger receives the banner and progress messages. It writes to stderr, so
+// stdout carries only what was asked for: the -json report or -o - code.
+var logger = &goshield.Logger{Out: os.Stderr}
+
+// =============================================================================
+// CONFIG FILE
+// =============================================================================
+
+// loadConfig applies a YAML or JSON config file to opts. Keys are flag names
+// ("no-ints", "string-mode", ...); flags given on the command line keep their
+// value, under any of their aliases. Keys are applied in sorted order, and
+// setting one option under two aliases is an error.
+func loadConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %v", err)
+	}
+
+	var values map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		values, err = parseJSONConfig(data)
+	case ".yaml", ".yml":
+		values, err = parseYAMLConfig(data)
+	default:
+		return fmt.Errorf("config %s: unknown format (use .json, .yaml or .yml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config %s: %v", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[option(f.Name)] = true })
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	set := make(map[string]string)
+	for _, key := range keys {
+		if key == "config" || flag.Lookup(key) == nil {
+			return fmt.Errorf("config %s: unknown option %q", path, key)
+		}
+		name := option(key)
+		if other, ok := set[name]; ok {
+			return fmt.Errorf("config %s: %q and %q set the same option", path, other, key)
+		}
+		set[name] = key
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(key, values[key]); err != nil {
+			return fmt.Errorf("config %s: %s: %v", path, key, err)
+		}
+	}
+	return nil
+}
+
+// option returns the name of the first flag, in sorted order, bound to the
+// same variable as the flag name, so aliases such as -min-backtick-len and
+// -backtick-min-len count as one option.
+func option(name string) string {
+	value := flag.Lookup(name).Value
+	first := name
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Value == value && f.Name < first {
+			first = f.Name
+		}
+	})
+	return first
+}
+
+// parseJSONConfig reads a flat JSON object. Lists become comma-separated
+// values, matching the flags that take lists.
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for key, value := range raw {
+		switch v := value.(type) {
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case map[string]interface{}, nil:
+			return nil, fmt.Errorf("%s: expected a string, number, boolean or list", key)
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// parseYAMLConfig reads the flat subset of YAML a config needs: "key: value"
+// lines, # comments, quoted strings and [a, b] lists.
+func parseYAMLConfig(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("line %d: expected key: value", i+1)
+		}
+		key := strings.TrimSpace(line[:colon])
+		value, err := yamlScalar(strings.TrimSpace(line[colon+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func yamlScalar(value string) (string, error) {
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+		quote := value[:1]
+		end := strings.LastIndex(value, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		if quote == `"` {
+			return strconv.Unquote(value[:end+1])
+		}
+		return strings.Replace(value[1:end], "''", "'", -1), nil
+	}
+
+	if hash := strings.Index(value, " #"); hash >= 0 {
+		value = strings.TrimSpace(value[:hash])
+	}
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		var items []string
+		for _, item := range strings.Split(value[1:len(value)-1], ",") {
+			item, err := yamlScalar(strings.TrimSpace(item))
+			if err != nil {
+				return "", err
+			}
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+		return strings.Join(items, ","), nil
+	}
+	if value == "" {
+		return "", fmt.Errorf("nested values are not supported")
+	}
+	return value, nil
+}
+
+// printScore logs the -score breakdown.
+func printScore(sc *goshield.Score) {
+	if logger.JSON {
+		logger.Log("info", "", map[string]interface{}{"score": sc}, "Score: %d/100", sc.Total)
+		return
+	}
+	logger.Success("Score: %d/100", sc.Total)
+	logger.Info("  Identifiers renamed:  %3d%%", sc.Identifiers)
+	logger.Info("  Strings encoded:      %3d%%", sc.Strings)
+	logger.Info("  Integers transformed: %3d%%", sc.Integers)
+	logger.Info("  Name entropy:         %3d%%", sc.NameEntropy)
+	logger.Info("  Control flow:         %3d%%", sc.ControlFlow)
+}
+
+// =============================================================================
+// WATCH
+// =============================================================================
+
+const (
+	watchInterval = 250 * time.Millisecond
+	// watchSettle is how long the inputs must stay unchanged before a run, so
+	// an editor saving several times in a row triggers a single run
+	watchSettle = 500 * time.Millisecond
+)
+
+// watchSnapshot holds the size and modification time of each watched file.
+type watchSnapshot map[string]string
+
+func takeSnapshot(paths []string) watchSnapshot {
+	snap := make(watchSnapshot)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			snap[path] = "missing"
+			continue
+		}
+		snap[path] = fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+	}
+	return snap
+}
+
+func (s watchSnapshot) equal(other watchSnapshot) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for path, stamp := range s {
+		if other[path] != stamp {
+			return false
+		}
+	}
+	return true
+}
+
+// watchInputs obfuscates the inputs again each time they change, until the
+// process is interrupted. It polls instead of subscribing to file events;
+// with -dir the directory is listed on every poll, so added and removed
+// files count as changes. The regular log is silenced: each run prints one
+// status line instead, plus its summary on one line with -json. With -quiet
+// only the lines of failed runs are printed.
+func watchInputs(explicit []string) {
+	// Reusing one seed keeps the names, and so the diffs between runs, stable
+	if opts.Seed == "" && opts.SeedFile == "" {
+		opts.Seed = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	status := *logger
+	logger.Out = nil
+	status.Log("info", "[+]", map[string]interface{}{"seed": opts.Seed},
+		"Watching for changes (seed %s), Ctrl-C to stop", opts.Seed)
+
+	var last watchSnapshot
+	var changed time.Time
+	pending := false
+	for {
+		inputs := explicit
+		if opts.Dir != "" {
+			paths, _ := goshield.ListGoFiles(opts.Dir, opts.IncludeTests, logger)
+			inputs = append(append([]string(nil), explicit...), paths...)
+		}
+		if snap := takeSnapshot(inputs); !snap.equal(last) {
+			last = snap
+			changed = time.Now()
+			pending = true
+		}
+		if pending && time.Since(changed) >= watchSettle {
+			pending = false
+			runWatched(&status, inputs)
+		}
+		time.Sleep(watchInterval)
+	}
+}
+
+// runWatched is one -watch run, reported on a single line of status.
+func runWatched(status *goshield.Logger, inputs []string) {
+	start := time.Now()
+	stamp := start.Format("15:04:05")
+
+	outputs := []string{opts.Output}
+	var err error
+	if len(inputs) == 0 {
+		err = fmt.Errorf("no .go files found in %s", opts.Dir)
+	} else if (len(inputs) > 1 || opts.Dir != "") && !mergesInputs(inputs) {
+		outputs, err = batchOutputs(inputs)
+	}
+	var result *goshield.Stats
+	if err == nil {
+		result, err = goshield.Obfuscate(context.Background(), inputs, outputs, opts)
+	}
+	if err == nil && *reportFile != "" {
+		err = writeReport(*reportFile, result, time.Since(start), inputs, outputs)
+	}
+	if err != nil {
+		message := strings.Replace(err.Error(), "\n", "; ", -1)
+		if status.JSON {
+			status.Log("error", "", nil, "%s", message)
+		} else {
+			fmt.Fprintf(status.Out, "[%s] failed: %s\n", stamp, message)
+		}
+		return
+	}
+
+	if *jsonOut {
+		data, err := json.Marshal(result)
+		if err == nil {
+			fmt.Println(string(data))
+		}
+	}
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if status.JSON {
+		status.Log("info", "", map[string]interface{}{
+			"files": result.Files, "renamed": result.Renamed, "strings": result.Strings,
+			"integers": result.Integers, "elapsed_ms": elapsed.Milliseconds(),
+		}, "Obfuscated %d files", result.Files)
+		return
+	}
+	status.Plain("[%s] ok: %d files, %d renamed, %d strings, %d integers (%s)\n",
+		stamp, result.Files, result.Renamed, result.Strings, result.Integers, elapsed)
+}
+
+// =============================================================================
+// MAIN
+// =============================================================================
+
+// report is the -report file: the run's Stats plus what a CI job needs to
+// tell runs apart.
+type report struct {
+	goshield.Stats
+	ElapsedMS int64    `json:"elapsed_ms"`
+	Inputs    []string `json:"inputs"`
+	Outputs   []string `json:"outputs"`
+	DryRun    bool     `json:"dry_run"`
+}
+
+func writeReport(path string, stats *goshield.Stats, elapsed time.Duration, inputs, outputs []string) error {
+	data, err := json.MarshalIndent(report{
+		Stats:     *stats,
+		ElapsedMS: elapsed.Milliseconds(),
+		Inputs:    inputs,
+		Outputs:   outputs,
+		DryRun:    opts.DryRun,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// mergesInputs reports whether the command merges inputs into one file:
+// several files given by -i or as arguments, and an -o naming a .go file or
+// stdout.
+func mergesInputs(inputs []string) bool {
+	return len(inputs) > 1 && opts.Dir == "" && (opts.Output == "-" || strings.HasSuffix(opts.Output, ".go"))
+}
+
+// batchOutputs maps each of several inputs to its file in the -o directory.
+func batchOutputs(inputs []string) ([]string, error) {
+	var outputs []string
+	seen := make(map[string]string)
+	for _, path := range inputs {
+		base := filepath.Base(path)
+		if other, exists := seen[base]; exists {
+			return nil, fmt.Errorf("Inputs %s and %s would both be written to %s", other, path, base)
+		}
+		seen[base] = path
+		outputs = append(outputs, filepath.Join(opts.Output, base))
+	}
+	return outputs, nil
+}
+
+// printUsage writes the usage text to stderr, like every message, so
+// stdout stays clean for -o -.
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: goshield -i <input.go> -o <output.go> [options]")
+	fmt.Fprintln(out, "       goshield -i <a.go,b.go> -o <output dir> [options]")
+	fmt.Fprintln(out, "       goshield -i <a.go> -i <b.go> -o <merged.go> [options]")
+	fmt.Fprintln(out, "       goshield -dir <input dir> -o <output dir> [options]")
+	fmt.Fprintln(out, "\nOptions:")
+	flag.PrintDefaults()
+}
+
+func printBanner() {
+	logger.Plain(`
+   ██████╗  ██████╗ ███████╗██╗  ██╗██╗███████╗██╗     ██████╗
+  ██╔════╝ ██╔═══██╗██╔════╝██║  ██║██║██╔════╝██║     ██╔══██╗
+  ██║  ███╗██║   ██║███████╗███████║██║█████╗  ██║     ██║  ██║
+  ██║   ██║██║   ██║╚════██║██╔══██║██║██╔══╝  ██║     ██║  ██║
+  ╚██████╔╝╚██████╔╝███████║██║  ██║██║███████╗███████╗██████╔╝
+   ╚═════╝  ╚═════╝ ╚══════╝╚═╝  ╚═╝╚═╝╚══════╝╚══════╝╚═════╝
+                    Go Source Code Obfuscator v%s
+
+`, version)
+}
+
+// printVersion prints the version and, for binaries built from a module
+// checkout, the commit they were built from.
+func printVersion() {
+	fmt.Printf("goshield %s\n", version)
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	settings := make(map[string]string)
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if revision := settings["vcs.revision"]; revision != "" {
+		if settings["vcs.modified"] == "true" {
+			revision += " (modified)"
+		}
+		fmt.Printf("revision %s %s\n", revision, settings["vcs.time"])
+	}
+	fmt.Printf("built with %s\n", info.GoVersion)
+}
+
+func main() {
+	flag.Parse()
+	opts.Log = logger
+
+	if *showVer {
+		printVersion()
+		return
+	}
+
+	// Deobfuscation writes only the translated text, so no banner
+	if *deobf {
+		if opts.MapIn == "" {
+			fmt.Fprintln(os.Stderr, "Usage: goshield -deobf -map-in <map.json> < trace.txt")
+			os.Exit(1)
+		}
+		if err := goshield.Deobfuscate(os.Stdin, os.Stdout, opts.MapIn); err != nil {
+			fmt.Fprintf(os.Stderr, "deobfuscate: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Watermark extraction prints only the watermarks found, one per line
+	if *extractWM {
+		paths := append(opts.InputFiles(), flag.Args()...)
+		if opts.Dir != "" {
+			dirPaths, err := goshield.ListGoFiles(opts.Dir, true, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "extract-watermark: %v\n", err)
+				os.Exit(1)
+			}
+			paths = append(paths, dirPaths...)
+		}
+		if len(paths) == 0 {
+			fmt.Fprintln(os.Stderr, "Usage: goshield -extract-watermark -i <file.go> | -dir <dir>")
+			os.Exit(1)
+		}
+		found := 0
+		for _, path := range paths {
+			src, err := ioutil.ReadFile(path)
+			if err == nil {
+				var marks []string
+				marks, err = goshield.ExtractWatermarks(path, src)
+				for _, mark := range marks {
+					fmt.Println(mark)
+					found++
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "extract-watermark: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if found == 0 {
+			fmt.Fprintln(os.Stderr, "extract-watermark: no watermark found")
+			os.Exit(1)
+		}
+		return
+	}
+
+	printBanner()
+
+	if *configFile != "" {
+		if err := loadConfig(*configFile); err != nil {
+			logger.Error("%v", err)
+			os.Exit(1)
+		}
+	}
+
+	inputs := append(opts.InputFiles(), flag.Args()...)
+
+	if (len(inputs) == 0 && opts.Dir == "") || (opts.Output == "" && !opts.DryRun) {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if err := opts.Validate(); err != nil {
+		logger.Error("%v", err)
+		os.Exit(1)
+	}
+
+	explicit := inputs
+	if opts.Dir != "" {
+		paths, err := goshield.ListGoFiles(opts.Dir, opts.IncludeTests, logger)
+		if err != nil {
+			logger.Error("Read dir failed: %v", err)
+			os.Exit(1)
+		}
+		if len(paths) == 0 {
+			logger.Error("No .go files found in %s", opts.Dir)
+			os.Exit(1)
+		}
+		inputs = append(append([]string(nil), inputs...), paths...)
+	}
+
+	// Several inputs share one rename map and land in the -o directory,
+	// or are merged when -o names a single file
+	batch := (len(inputs) > 1 || opts.Dir != "") && !mergesInputs(inputs)
+	outputs := []string{opts.Output}
+	if batch && opts.Output == "-" {
+		logger.Error("-o - prints a single file; use an output directory for several inputs")
+		os.Exit(1)
+	}
+	if *jsonOut && opts.Output == "-" && !opts.DryRun {
+		logger.Error("-json and -o - both write to stdout")
+		os.Exit(1)
+	}
+	if batch {
+		var err error
+		if outputs, err = batchOutputs(inputs); err != nil {
+			logger.Error("%v", err)
+			os.Exit(1)
+		}
+		if !opts.DryRun {
+			if err := goshield.PrepareOutputDir(opts.Output); err != nil {
+				logger.Error("%v", err)
+				os.Exit(1)
+			}
+		}
+		logger.Plain("\n  Input:  %d files\n", len(inputs))
+	} else if len(inputs) > 1 {
+		logger.Plain("\n  Input:  %d files, merged\n", len(inputs))
+	} else {
+		logger.Plain("\n  Input:  %s\n", inputs[0])
+	}
+	logger.Plain("  Output: %s\n\n", opts.Output)
+	if logger.JSON {
+		logger.Log("info", "", map[string]interface{}{"inputs": inputs, "output": opts.Output},
+			"Obfuscating %d files", len(inputs))
+	}
+
+	if *watch {
+		watchInputs(explicit)
+	}
+
+	logger.Plain("  Processing...\n")
+
+	start := time.Now()
+	result, err := goshield.Obfuscate(context.Background(), inputs, outputs, opts)
+	if err != nil {
+		logger.Error("%v", err)
+		os.Exit(1)
+	}
+
+	if *reportFile != "" {
+		if err := writeReport(*reportFile, result, time.Since(start), inputs, outputs); err != nil {
+			logger.Error("Write report failed: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	if *jsonOut {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			logger.Error("%v", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	logger.Plain("\n")
+	if opts.DryRun {
+		logger.Success("Dry run complete, nothing written")
+		logger.Success("Files analyzed: %d", result.Files)
+		logger.Success("Identifiers that would be renamed: %d", result.Renamed)
+		logger.Success("Strings that would be encoded: %d", result.Strings)
+		logger.Success("Embedded code blocks that would be encoded: %d", result.EmbeddedCode)
+		logger.Success("Integers that would be transformed: %d", result.Integers)
+		if opts.SwitchToIf {
+			logger.Success("Switch statements that would be rewritten: %d", result.Switches)
+		}
+		if len(result.Reserved) > 0 {
+			logger.Success("Kept reserved names: %s", strings.Join(result.Reserved, ", "))
+		}
+		if result.Score != nil {
+			printScore(result.Score)
+		}
+		logger.Plain("\n")
+		return
+	}
+	logger.Success("Obfuscation complete!")
+	logger.Success("Identifiers renamed: %d", result.Renamed)
+	if result.Score != nil {
+		printScore(result.Score)
+	}
+	if opts.Output == "-" {
+		return
+	}
+	if logger.JSON {
+		logger.Log("info", "", map[string]interface{}{"output": opts.Output}, "Output saved to %s", opts.Output)
+	}
+	logger.Plain("\n  Output saved to: %s\n\n", opts.Output)
+}
@@ -0,0 +1,3 @@
+module github.com/rafaelwdornelas/goshield
+
+go 1.22
@@ -8,67 +8,157 @@
 // - JavaScript/embedded code obfuscation
 // - Import aliasing
 // - Comment removal
-//
-// Usage:
-//   goshield -i input.go -o output.go [options]
-//
-// Options:
-//   -i              Input file path (required)
-//   -o              Output file path (required)
-//   -seed           Seed for reproducible output
-//   -no-ints        Disable integer obfuscation
-//   -no-strings     Disable string obfuscation
-//   -no-vars        Disable variable name obfuscation
-//   -no-functions   Disable function name obfuscation
-//   -no-imports     Disable import alias obfuscation
-//   -minify         Minify output (remove newlines, single line)
-//   -v              Verbose output
-
-package main
+
+// Package goshield is the library behind the goshield command: Obfuscate
+// and ObfuscateDir run every pass over a set of files with the settings of
+// an Options value, and each call keeps its own rename map and random
+// source, so calls may run concurrently.
+package goshield
 
 import (
-	"flag"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/build/constraint"
+	"go/constant"
+	"go/importer"
 	"go/parser"
 	"go/printer"
+	"go/scanner"
 	"go/token"
+	"go/types"
 	"hash/fnv"
+	"io"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // =============================================================================
 // CONFIGURATION
 // =============================================================================
 
-var (
-	inputFile  = flag.String("i", "", "Input Go file path")
-	outputFile = flag.String("o", "", "Output Go file path")
-	seed       = flag.String("seed", "", "Seed for reproducible obfuscation")
-	verbose    = flag.Bool("v", false, "Verbose output")
-
-	noInts      = flag.Bool("no-ints", false, "Disable integer obfuscation")
-	noStrings   = flag.Bool("no-strings", false, "Disable string obfuscation")
-	noVars      = flag.Bool("no-vars", false, "Disable variable obfuscation")
-	noFunctions = flag.Bool("no-functions", false, "Disable function obfuscation")
-	noImports   = flag.Bool("no-imports", false, "Disable import obfuscation")
-	minify      = flag.Bool("minify", false, "Minify output (remove newlines, single line)")
-)
+// Options holds every setting that controls an obfuscation run. The
+// command-line flags and -config files both fill it.
+type Options struct {
+	Input    string
+	Output   string
+	Dir      string
+	Seed     string
+	SeedFile string
+	Salt     string
+	MapIn    string
+	MapOut   string
+	Verbose  bool
+
+	NoInts       bool
+	IntMin       int64
+	IntMax       int64
+	NoStrings    bool
+	NoVars       bool
+	NoFunctions  bool
+	NoImports    bool
+	KeepImports  string
+	NoLabels     bool
+	NoConsts     bool
+	Poly         bool
+	SwitchToIf   bool
+	Split        int
+	Minify       bool
+	KeepHeader   bool
+	KeepComments bool
+	// GarbleComments keeps comments in place but replaces their text with
+	// random characters, so line numbers match the input
+	GarbleComments bool
+	Watermark      string
+	TamperCheck    bool
+	Integrity      bool
+	TamperHandler  string
+	Expire         string
+	ExpireMessage  string
+	StringMode     string
+	NameLen        int
+
+	NoBackticks    bool
+	ObfuscateURLs  bool
+	KeepStrings    string
+	MinStringLen   int
+	MinBacktickLen int
+	CodeMarkers    string
+
+	OnlyFuncs           string
+	KeepExported        bool
+	KeepExportedMethods bool
+	KeepExportedFields  bool
+	OnlyUnexported      bool
+	OnlyExported        bool
+	FuncPattern         string
+	TypePattern         string
+	Fields              bool
+	FieldTags           string
+	RenamePackage       bool
+	SkipTemplates       bool
+	SplitTemplates      bool
+
+	ObfuscateGenerated bool
+	NoTypeCheck        bool
+	SkipTypeCheck      bool
+	NoReflectNames     bool
+	IncludeTests       bool
+	DryRun             bool
+	Score              bool
+	Jobs               int
+	Force              bool
+	MaxFileSize        int
+
+	// Progress is called as each stage of Obfuscate starts and ends; may be nil
+	Progress ProgressFunc
+	// Passes run in order after the built-in renaming and integer passes,
+	// before strings are encoded
+	Passes []Pass
+	// Log receives the messages of the run; nil discards them
+	Log *Logger
+}
+
+// DefaultOptions returns the settings of the goshield command run without
+// flags.
+func DefaultOptions() Options {
+	return Options{
+		IntMin:         11,
+		IntMax:         100000,
+		ExpireMessage:  "This build has expired",
+		StringMode:     "concat",
+		NameLen:        20,
+		MinStringLen:   3,
+		MinBacktickLen: 20,
+		CodeMarkers:    strings.Join(defaultCodeMarkers, ","),
+		FieldTags:      strings.Join(defaultFieldTags, ","),
+		MaxFileSize:    10,
+	}
+}
 
 // =============================================================================
-// GLOBAL STATE
+// SHARED TABLES
 // =============================================================================
 
-var nameMap = make(map[string]string)
-var structTypeMapping = make(map[string]string)
-var typeAliasMapping = make(map[string]string)
-
 // Unicode lookalike characters for maximum confusion
 var obfuscationChars = []rune{
 	'O', '0', 'o', // O, zero, lowercase o
@@ -86,6 +176,18 @@ var obfuscationChars = []rune{
 	'T', 'Т', // Latin T, Cyrillic Т
 }
 
+// Substrings that mark a backtick string as embedded code (JavaScript, etc.)
+var defaultCodeMarkers = []string{
+	"function", "await", "async", "const ", "var ", "let ", "try {", "catch", "return ",
+}
+
+// Struct tag keys -fields fills in for renamed exported fields
+var defaultFieldTags = []string{"json", "xml", "yaml", "toml", "mapstructure"}
+
+// structTagRe matches a backtick string holding a struct tag such as
+// `db:"id" validate:"required"`
+var structTagRe = regexp.MustCompile("`\\s*[A-Za-z_][A-Za-z0-9_.-]*:\"")
+
 // Reserved names that should never be obfuscated (stdlib interfaces/methods)
 var reservedNames = map[string]bool{
 	"Error": true, "String": true,
@@ -96,28 +198,120 @@ var reservedNames = map[string]bool{
 	"Context": true, "Err": true, "Done": true, "Value": true, "Deadline": true,
 	"Lock": true, "Unlock": true, "RLock": true, "RUnlock": true,
 	"ID": true, "URL": true, "URI": true, "HTML": true,
+	"XMLName": true,
 }
 
 // =============================================================================
 // LOGGING
 // =============================================================================
 
-func logDebug(format string, args ...interface{}) {
-	if *verbose {
-		fmt.Printf("  [DEBUG] "+format+"\n", args...)
+// Logger writes the messages of a run to Out: text lines after a mark such
+// as [+] or [!], or with JSON one logRecord per line. A nil Logger, or one
+// without Out, discards them.
+type Logger struct {
+	Out  io.Writer
+	JSON bool
+	// Quiet drops every message but errors
+	Quiet bool
+	// verbose adds the debug messages, set from Options.Verbose for a run
+	verbose bool
+}
+
+// logRecord is one -log-json message. Level is debug, info or error;
+// fields carry the values of messages about the run as a whole.
+type logRecord struct {
+	Time   string                 `json:"time"`
+	Level  string                 `json:"level"`
+	Msg    string                 `json:"msg"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Log writes a message at level, as text after mark or as a logRecord
+// carrying fields.
+func (l *Logger) Log(level, mark string, fields map[string]interface{}, format string, args ...interface{}) {
+	if l == nil || l.Out == nil || l.Quiet && level != "error" {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if !l.JSON {
+		fmt.Fprintf(l.Out, "  %s %s\n", mark, msg)
+		return
+	}
+	data, err := json.Marshal(logRecord{
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:  level,
+		Msg:    msg,
+		Fields: fields,
+	})
+	if err != nil {
+		data, _ = json.Marshal(logRecord{Level: "error", Msg: err.Error()})
+	}
+	fmt.Fprintf(l.Out, "%s\n", data)
+}
+
+// Plain writes undecorated text such as the banner, left out with JSON or
+// Quiet.
+func (l *Logger) Plain(format string, args ...interface{}) {
+	if l != nil && l.Out != nil && !l.JSON && !l.Quiet {
+		fmt.Fprintf(l.Out, format, args...)
 	}
 }
 
-func logInfo(format string, args ...interface{}) {
-	fmt.Printf("  [+] "+format+"\n", args...)
+func (l *Logger) Debug(format string, args ...interface{}) {
+	if l != nil && l.verbose {
+		l.Log("debug", "[DEBUG]", nil, format, args...)
+	}
+}
+
+func (l *Logger) Info(format string, args ...interface{}) {
+	l.Log("info", "[+]", nil, format, args...)
+}
+
+func (l *Logger) Error(format string, args ...interface{}) {
+	l.Log("error", "[!]", nil, format, args...)
+}
+
+func (l *Logger) Success(format string, args ...interface{}) {
+	l.Log("info", "[✓]", nil, format, args...)
 }
 
-func logError(format string, args ...interface{}) {
-	fmt.Printf("  [!] "+format+"\n", args...)
+// =============================================================================
+// SEED
+// =============================================================================
+
+// resolveSeed returns the seed string for a run with opts. Without -seed or
+// -seed-file a random one is generated; passing it back via -seed reproduces
+// the run.
+func resolveSeed(opts Options) (string, error) {
+	if opts.Seed != "" && opts.SeedFile != "" {
+		return "", fmt.Errorf("use either -seed or -seed-file, not both")
+	}
+	if opts.SeedFile != "" {
+		content, err := ioutil.ReadFile(opts.SeedFile)
+		if err != nil {
+			return "", fmt.Errorf("read seed file: %v", err)
+		}
+		value := strings.TrimSpace(string(content))
+		if value == "" {
+			return "", fmt.Errorf("seed file %s is empty", opts.SeedFile)
+		}
+		return value, nil
+	}
+	if opts.Seed != "" {
+		return opts.Seed, nil
+	}
+	return strconv.FormatInt(time.Now().UnixNano(), 10), nil
 }
 
-func logSuccess(format string, args ...interface{}) {
-	fmt.Printf("  [✓] "+format+"\n", args...)
+// saltSeed mixes the -salt text and the input paths into seed: the same
+// source under another path, or with another salt, gets other names and
+// encodings, while the same inputs and salt reproduce the run.
+func saltSeed(seed int64, salt string, inputs []string) int64 {
+	key := strconv.FormatInt(seed, 10) + "\x00" + salt
+	for _, path := range inputs {
+		key += "\x00" + filepath.ToSlash(filepath.Clean(path))
+	}
+	return int64(hashString(key))
 }
 
 // =============================================================================
@@ -130,81 +324,191 @@ func hashString(s string) uint64 {
 	return h.Sum64()
 }
 
-func generateObfuscatedName(length int) string {
+func (o *Obfuscator) generateObfuscatedName(length int) string {
+	return randomName(o.rng, length)
+}
+
+// randomName draws a name of the given length from r.
+func randomName(r *rand.Rand, length int) string {
 	letters := []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 	result := make([]rune, length)
-	result[0] = letters[rand.Intn(len(letters))]
+	result[0] = letters[r.Intn(len(letters))]
 	for i := 1; i < length; i++ {
-		result[i] = obfuscationChars[rand.Intn(len(obfuscationChars))]
+		result[i] = obfuscationChars[r.Intn(len(obfuscationChars))]
 	}
 	return string(result)
 }
 
-func getObfuscatedName(original string) string {
-	if existing, ok := nameMap[original]; ok {
+// keepName reports whether the options protect an identifier from renaming.
+// Every rename goes through getObfuscatedName, so one check covers all passes.
+// Reserved names are filtered before this and stay untouched in every mode.
+func (o *Obfuscator) keepName(name string) bool {
+	if ast.IsExported(name) {
+		return o.opts.KeepExported || o.opts.OnlyUnexported
+	}
+	return o.opts.OnlyExported
+}
+
+func (o *Obfuscator) getObfuscatedName(original string) string {
+	if existing, ok := o.nameMap[original]; ok {
 		return existing
 	}
+	if o.keepName(original) {
+		o.nameMap[original] = original
+		return original
+	}
+
+	// Keep the export status so reflection and other packages still see it
+	newName := o.uniqueName(ast.IsExported(original))
+	o.nameMap[original] = newName
+	o.log.Debug("Rename: %s -> %s", original, newName)
+	return newName
+}
 
-	var newName string
+// uniqueName draws a new name, exported or not, that is neither the new name
+// of another identifier nor one reserved for code the run adds.
+func (o *Obfuscator) uniqueName(exported bool) string {
 	for {
-		newName = generateObfuscatedName(20)
-		exists := false
-		for _, v := range nameMap {
+		newName := o.generateObfuscatedName(o.opts.NameLen)
+		if exported {
+			newName = strings.ToUpper(newName[:1]) + newName[1:]
+		} else {
+			newName = strings.ToLower(newName[:1]) + newName[1:]
+		}
+		exists := o.reserved[newName]
+		for _, v := range o.nameMap {
 			if v == newName {
 				exists = true
 				break
 			}
 		}
 		if !exists {
-			break
+			return newName
 		}
 	}
+}
 
-	nameMap[original] = newName
-	logDebug("Rename: %s -> %s", original, newName)
-	return newName
+// reserveName returns an unexported name for a declaration or import the
+// run adds (the watermark, the tamper and expiry checks). Besides the new
+// names it avoids every identifier of the files, so it must be called once
+// the renaming passes are done.
+func (o *Obfuscator) reserveName() string {
+	if o.reserved == nil {
+		o.reserved = make(map[string]bool)
+		for _, file := range append(o.files[:len(o.files):len(o.files)], o.copied...) {
+			ast.Inspect(file, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok {
+					o.reserved[ident.Name] = true
+				}
+				return true
+			})
+		}
+	}
+	name := o.uniqueName(false)
+	o.reserved[name] = true
+	return name
 }
 
 // =============================================================================
 // STRING OBFUSCATION
 // =============================================================================
 
-func obfuscateStringLiteral(s string) string {
+// textEncoder holds what the text passes need for one file: the settings of
+// the run and the -only-funcs selection, its own random source, so files can
+// be encoded in parallel with the same result as one after the other, the
+// names of its runtime decoders (empty until a string is routed through
+// one), the string table of -string-mode table, the variables -poly hoisted
+// strings into and the counts for Stats.
+type textEncoder struct {
+	opts         *Options
+	log          *Logger
+	keepStrings  *regexp.Regexp
+	selected     map[string]bool
+	rng          *rand.Rand
+	xorFunc      string
+	base64Func   string
+	tableFunc    string
+	hoisted      []string
+	table        []byte
+	tableOffsets []int
+	tableIndex   map[string]int
+	watermark    string
+	tamper       *tamperGuard
+	expiry       *expiryGuard
+	strings      int
+	embeddedCode int
+}
+
+func (e *textEncoder) obfuscateStringLiteral(s string) string {
 	if s == "" {
 		return `""`
 	}
 
 	var parts []string
 	for _, r := range s {
-		switch rand.Intn(4) {
+		switch e.rng.Intn(4) {
 		case 0:
-			parts = append(parts, fmt.Sprintf("string(%d)", r))
+			parts = append(parts, fmt.Sprintf("string(rune(%d))", r))
 		case 1:
-			parts = append(parts, fmt.Sprintf("string(0x%x)", r))
+			parts = append(parts, fmt.Sprintf("string(rune(0x%x))", r))
 		case 2:
-			offset := rand.Intn(50) + 1
-			parts = append(parts, fmt.Sprintf("string(%d+%d)", int(r)-offset, offset))
+			offset := e.rng.Intn(50) + 1
+			parts = append(parts, fmt.Sprintf("string(rune(%d+%d))", int(r)-offset, offset))
 		default:
 			if r == '"' || r == '\\' || r > 127 {
-				parts = append(parts, fmt.Sprintf("string(%d)", r))
+				parts = append(parts, fmt.Sprintf("string(rune(%d))", r))
 			} else if r >= 32 && r < 127 {
 				parts = append(parts, fmt.Sprintf(`"%c"`, r))
 			} else {
-				parts = append(parts, fmt.Sprintf("string(%d)", r))
+				parts = append(parts, fmt.Sprintf("string(rune(%d))", r))
 			}
 		}
 	}
 	return "(" + strings.Join(parts, "+") + ")"
 }
 
-func obfuscateFormatString(s string) string {
-	// Regex to match Go format specifiers: %d, %s, %v, %f, %10.2f, %-5s, %+d, %#x, %%, etc.
-	formatRe := regexp.MustCompile(`%[-+#0 ]*[0-9]*(\.[0-9]+)?[dsvftxXboqpeEgGUcTw%]`)
+// formatVerbRe matches Go format specifiers: %d, %s, %v, %f, %10.2f, %-5s,
+// %+d, %#x, %%, plus explicit argument indexes and * widths (%[1]w, %*d,
+// %[2]*.[1]f). Each specifier stays one literal so %w and friends are never
+// split.
+var formatVerbRe = regexp.MustCompile(`%[-+#0 ]*(\[[0-9]+\])?([0-9]+|\*)?(\.(\[[0-9]+\])?([0-9]+|\*)?)?(\[[0-9]+\])?[dsvftxXboOqpeEFgGUcTw%]`)
+
+// constStringLiteral encodes s as a concatenation of escaped literals. Unlike
+// string(rune(N)) the result is an untyped constant, so it still fits const
+// declarations, array lengths and named string types.
+func (e *textEncoder) constStringLiteral(s string) string {
+	if s == "" {
+		return `""`
+	}
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch e.rng.Intn(3) {
+		case 0:
+			fmt.Fprintf(&part, "\\x%02x", c)
+		case 1:
+			fmt.Fprintf(&part, "\\%03o", c)
+		default:
+			if c >= 32 && c < 127 && c != '"' && c != '\\' {
+				part.WriteByte(c)
+			} else {
+				fmt.Fprintf(&part, "\\x%02x", c)
+			}
+		}
+		if e.rng.Intn(4) == 0 || i == len(s)-1 {
+			parts = append(parts, `"`+part.String()+`"`)
+			part.Reset()
+		}
+	}
+	return "(" + strings.Join(parts, "+") + ")"
+}
 
+func (e *textEncoder) obfuscateFormatString(s string) string {
 	// Find all format specifiers and their positions
-	matches := formatRe.FindAllStringIndex(s, -1)
+	matches := formatVerbRe.FindAllStringIndex(s, -1)
 	if len(matches) == 0 {
-		return obfuscateStringLiteral(s)
+		return e.obfuscateStringLiteral(s)
 	}
 
 	var parts []string
@@ -217,7 +521,7 @@ func obfuscateFormatString(s string) string {
 		if start > lastEnd {
 			textPart := s[lastEnd:start]
 			if len(textPart) > 0 {
-				parts = append(parts, obfuscateStringLiteral(textPart))
+				parts = append(parts, e.obfuscateStringLiteral(textPart))
 			}
 		}
 
@@ -232,7 +536,7 @@ func obfuscateFormatString(s string) string {
 	if lastEnd < len(s) {
 		textPart := s[lastEnd:]
 		if len(textPart) > 0 {
-			parts = append(parts, obfuscateStringLiteral(textPart))
+			parts = append(parts, e.obfuscateStringLiteral(textPart))
 		}
 	}
 
@@ -240,441 +544,3950 @@ func obfuscateFormatString(s string) string {
 }
 
 // =============================================================================
-// INTEGER OBFUSCATION
+// RUNTIME DECODER
 // =============================================================================
 
-func obfuscateInteger(n int64) string {
-	switch rand.Intn(4) {
-	case 0:
-		x := rand.Int63n(1000) + 1
-		return fmt.Sprintf("(%d+%d)", n-x, x)
-	case 1:
-		x := rand.Int63n(1000) + 1
-		return fmt.Sprintf("(%d-%d)", n+x, x)
-	case 2:
-		x := rand.Int63n(1000) + 1
-		return fmt.Sprintf("(%d^%d)", n^x, x)
-	default:
-		x := rand.Int63n(10) + 2
-		return fmt.Sprintf("(%d/%d)", n*x, x)
+var templatePlaceholderRe = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+
+// isTemplate reports whether s looks like a text/template or html/template body.
+func isTemplate(s string) bool {
+	return templatePlaceholderRe.MatchString(s)
+}
+
+func (e *textEncoder) xorEncodeString(s string) string {
+	if e.xorFunc == "" {
+		e.xorFunc = randomName(e.rng, e.opts.NameLen)
+	}
+	key := make([]byte, e.rng.Intn(8)+4)
+	keyParts := make([]string, len(key))
+	for i := range key {
+		key[i] = byte(e.rng.Intn(256))
+		keyParts[i] = strconv.Itoa(int(key[i]))
 	}
+	dataParts := make([]string, len(s))
+	for i := 0; i < len(s); i++ {
+		dataParts[i] = strconv.Itoa(int(s[i] ^ key[i%len(key)]))
+	}
+	return fmt.Sprintf("%s([]byte{%s}, []byte{%s})", e.xorFunc,
+		strings.Join(dataParts, ", "), strings.Join(keyParts, ", "))
 }
 
-// =============================================================================
-// AST UTILITIES
-// =============================================================================
+// base64EncodeString returns a decoder call on the base64 form of s. The
+// argument is a raw string so the string pass leaves it alone.
+func (e *textEncoder) base64EncodeString(s string) string {
+	if e.base64Func == "" {
+		e.base64Func = randomName(e.rng, e.opts.NameLen)
+	}
+	return e.base64Func + "(`" + base64.StdEncoding.EncodeToString([]byte(s)) + "`)"
+}
 
-func writeAST(filename string, file *ast.File, fset *token.FileSet) error {
-	f, err := os.Create(filename)
-	if err != nil {
-		return err
+// splitTemplate encodes the text around the {{template}} placeholders of s
+// with encode and leaves the placeholders as plain literals.
+func splitTemplate(s string, encode func(string) string) string {
+	var parts []string
+	lastEnd := 0
+	for _, match := range templatePlaceholderRe.FindAllStringIndex(s, -1) {
+		if match[0] > lastEnd {
+			parts = append(parts, encode(s[lastEnd:match[0]]))
+		}
+		parts = append(parts, strconv.Quote(s[match[0]:match[1]]))
+		lastEnd = match[1]
 	}
-	defer f.Close()
-	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 4}
-	return cfg.Fprint(f, fset, file)
+	if lastEnd < len(s) || len(parts) == 0 {
+		parts = append(parts, encode(s[lastEnd:]))
+	}
+	return "(" + strings.Join(parts, "+") + ")"
 }
 
-func parseFile(filename string) (*ast.File, *token.FileSet, error) {
-	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, filename, nil, 0) // No comments
-	if err != nil {
-		return nil, nil, err
+// tableEncodeString appends s to the file's string table, once per distinct
+// string, and returns the accessor call that reads it back.
+func (e *textEncoder) tableEncodeString(s string) string {
+	if e.tableFunc == "" {
+		e.tableFunc = randomName(e.rng, e.opts.NameLen)
+		e.tableOffsets = []int{0}
+		e.tableIndex = make(map[string]int)
 	}
-	return file, fset, nil
+	i, ok := e.tableIndex[s]
+	if !ok {
+		i = len(e.tableOffsets) - 1
+		e.tableIndex[s] = i
+		e.table = append(e.table, s...)
+		e.tableOffsets = append(e.tableOffsets, len(e.table))
+	}
+	return fmt.Sprintf("%s(%d)", e.tableFunc, i)
 }
 
-// =============================================================================
-// OBFUSCATOR STRUCT
-// =============================================================================
+// encodeWithDecoder routes s through the runtime decoder of -string-mode
+// (xor unless base64 or table; with -poly one drawn per string), leaving
+// {{template}} placeholders as plain literals.
+func (e *textEncoder) encodeWithDecoder(s string) string {
+	mode := e.opts.StringMode
+	if e.opts.Poly {
+		mode = []string{"xor", "base64", "table"}[e.rng.Intn(3)]
+	}
+	switch mode {
+	case "base64":
+		return splitTemplate(s, e.base64EncodeString)
+	case "table":
+		return splitTemplate(s, e.tableEncodeString)
+	}
+	return splitTemplate(s, e.xorEncodeString)
+}
 
-type Obfuscator struct {
-	file            *ast.File
-	fset            *token.FileSet
-	declaredFuncs   map[string]bool
-	declaredMethods map[string]bool
-	importAliases   map[string]string
-	structFields    map[string]bool
-	typeNames       map[string]bool
-	structTypes     map[string]bool
-	fieldNames      map[string]string
+// polyEncode encodes s in a style drawn for this literal: character codes or
+// one of the runtime decoders, and one time in four hoisted into a
+// package-level variable, so the file follows no single pattern.
+func (e *textEncoder) polyEncode(s string) string {
+	var encoded string
+	if e.rng.Intn(2) == 0 {
+		encode := e.obfuscateStringLiteral
+		if strings.Contains(s, "%") {
+			encode = e.obfuscateFormatString
+		}
+		if e.opts.SplitTemplates && isTemplate(s) {
+			encoded = splitTemplate(s, encode)
+		} else {
+			encoded = encode(s)
+		}
+	} else {
+		encoded = e.encodeWithDecoder(s)
+	}
+	if e.rng.Intn(4) > 0 {
+		return encoded
+	}
+	name := randomName(e.rng, e.opts.NameLen)
+	e.hoisted = append(e.hoisted, "var "+name+" = "+encoded)
+	return name
 }
 
-func NewObfuscator(file *ast.File, fset *token.FileSet) *Obfuscator {
-	return &Obfuscator{
-		file:            file,
-		fset:            fset,
-		declaredFuncs:   make(map[string]bool),
-		declaredMethods: make(map[string]bool),
-		importAliases:   make(map[string]string),
-		structFields:    make(map[string]bool),
-		typeNames:       make(map[string]bool),
-		structTypes:     make(map[string]bool),
-		fieldNames:      make(map[string]string),
+// injectDecoder appends the variables -poly hoisted strings into and the
+// runtime decoders the file's strings call.
+func (e *textEncoder) injectDecoder(content string) string {
+	for _, decl := range e.hoisted {
+		content += "\n" + decl + "\n"
 	}
+	e.hoisted = nil
+	if e.xorFunc != "" {
+		data := randomName(e.rng, e.opts.NameLen)
+		key := randomName(e.rng, e.opts.NameLen)
+		out := randomName(e.rng, e.opts.NameLen)
+		idx := randomName(e.rng, e.opts.NameLen)
+		content += "\nfunc " + e.xorFunc + "(" + data + ", " + key + " []byte) string {\n" +
+			"\t" + out + " := make([]byte, len(" + data + "))\n" +
+			"\tfor " + idx + " := range " + data + " {\n" +
+			"\t\t" + out + "[" + idx + "] = " + data + "[" + idx + "] ^ " + key + "[" + idx + "%len(" + key + ")]\n" +
+			"\t}\n" +
+			"\treturn string(" + out + ")\n" +
+			"}\n"
+		e.xorFunc = ""
+	}
+	if e.base64Func != "" {
+		pkg := randomName(e.rng, e.opts.NameLen)
+		data := randomName(e.rng, e.opts.NameLen)
+		out := randomName(e.rng, e.opts.NameLen)
+		content = importOnPackageLine(content, pkg+` "encoding/base64"`)
+		content += "\nfunc " + e.base64Func + "(" + data + " string) string {\n" +
+			"\t" + out + ", _ := " + pkg + ".StdEncoding.DecodeString(" + data + ")\n" +
+			"\treturn string(" + out + ")\n" +
+			"}\n"
+		e.base64Func = ""
+	}
+	if e.tableFunc != "" {
+		content = e.injectTable(content)
+	}
+	return content
+}
+
+// injectTable appends the string table: every string xor-ed with a random
+// key and packed in one byte slice, the offsets where each one starts, and the
+// accessor that decodes string i.
+func (e *textEncoder) injectTable(content string) string {
+	key := e.randomBytes(e.rng.Intn(8) + 8)
+	data := make([]byte, len(e.table))
+	for i, c := range e.table {
+		data[i] = c ^ key[i%len(key)]
+	}
+	offsets := make([]string, len(e.tableOffsets))
+	for i, off := range e.tableOffsets {
+		offsets[i] = strconv.Itoa(off)
+	}
+	dataVar := randomName(e.rng, e.opts.NameLen)
+	keyVar := randomName(e.rng, e.opts.NameLen)
+	offVar := randomName(e.rng, e.opts.NameLen)
+	idx := randomName(e.rng, e.opts.NameLen)
+	out := randomName(e.rng, e.opts.NameLen)
+	j := randomName(e.rng, e.opts.NameLen)
+	content += "\nvar " + dataVar + " = []byte{" + byteList(data) + "}\n" +
+		"\nvar " + keyVar + " = []byte{" + byteList(key) + "}\n" +
+		"\nvar " + offVar + " = []int{" + strings.Join(offsets, ", ") + "}\n" +
+		"\nfunc " + e.tableFunc + "(" + idx + " int) string {\n" +
+		"\t" + out + " := make([]byte, " + offVar + "[" + idx + "+1]-" + offVar + "[" + idx + "])\n" +
+		"\tfor " + j + " := range " + out + " {\n" +
+		"\t\t" + out + "[" + j + "] = " + dataVar + "[" + offVar + "[" + idx + "]+" + j + "] ^ " + keyVar + "[(" + offVar + "[" + idx + "]+" + j + ")%len(" + keyVar + ")]\n" +
+		"\t}\n" +
+		"\treturn string(" + out + ")\n" +
+		"}\n"
+	e.tableFunc = ""
+	return content
 }
 
 // =============================================================================
-// COLLECTION PASSES
+// INTEGER OBFUSCATION
 // =============================================================================
 
-func (o *Obfuscator) collectTypeNames() {
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		if typeSpec, ok := n.(*ast.TypeSpec); ok {
-			o.typeNames[typeSpec.Name.Name] = true
-		}
-		return true
-	})
+// obfuscateInteger returns an expression equal to n.
+func (o *Obfuscator) obfuscateInteger(n int64) string {
+	a, op, b := o.integerTransform(n)
+	return fmt.Sprintf("(%d%c%d)", a, op, b)
 }
 
-func (o *Obfuscator) collectDeclaredFunctions() {
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		fn, ok := n.(*ast.FuncDecl)
-		if !ok {
-			return true
-		}
-		name := fn.Name.Name
-		if name == "main" || name == "init" {
-			return true
-		}
-		if fn.Recv == nil {
-			o.declaredFuncs[name] = true
-		} else {
-			o.declaredMethods[name] = true
+// integerTransform splits n into a op b. Offsets and multipliers are checked
+// against n so no intermediate value leaves the int64 range, falling back to
+// XOR (which cannot overflow) near the limits.
+func (o *Obfuscator) integerTransform(n int64) (int64, byte, int64) {
+	x := o.rng.Int63n(1000) + 1
+	switch o.rng.Intn(4) {
+	case 0:
+		if n >= math.MinInt64+x {
+			return n - x, '+', x
 		}
-		return true
-	})
-}
-
-func (o *Obfuscator) collectStructFields() {
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		structType, ok := n.(*ast.StructType)
-		if !ok || structType.Fields == nil {
-			return true
+	case 1:
+		if n <= math.MaxInt64-x {
+			return n + x, '-', x
 		}
-		for _, field := range structType.Fields.List {
-			for _, name := range field.Names {
-				if !reservedNames[name.Name] {
-					o.structFields[name.Name] = true
-				}
-			}
+	case 3:
+		m := o.rng.Int63n(10) + 2
+		if n <= math.MaxInt64/m && n >= math.MinInt64/m {
+			return n * m, '/', m
 		}
-		return true
-	})
+	}
+	return n ^ x, '^', x
 }
 
-func (o *Obfuscator) collectStructTypes() {
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		typeSpec, ok := n.(*ast.TypeSpec)
-		if !ok {
-			return true
-		}
-		if _, isStruct := typeSpec.Type.(*ast.StructType); isStruct {
-			originalName := typeSpec.Name.Name
-			obfuscatedName := getObfuscatedName(originalName)
-			o.structTypes[originalName] = true
-			structTypeMapping[originalName] = obfuscatedName
-		} else {
-			originalName := typeSpec.Name.Name
-			obfuscatedName := getObfuscatedName(originalName)
-			typeAliasMapping[originalName] = obfuscatedName
+// polyInteger nests transforms: each operand of the one drawn for n is
+// transformed again or not, at random, up to depth levels.
+func (o *Obfuscator) polyInteger(n int64, depth int) string {
+	a, op, b := o.integerTransform(n)
+	operand := func(v int64) string {
+		if depth > 1 && o.rng.Intn(2) == 0 {
+			return o.polyInteger(v, depth-1)
 		}
-		return true
-	})
+		return strconv.FormatInt(v, 10)
+	}
+	left := operand(a)
+	return "(" + left + string(op) + operand(b) + ")"
 }
 
 // =============================================================================
-// OBFUSCATION PASSES
+// AST UTILITIES
 // =============================================================================
 
-func (o *Obfuscator) obfuscateConsts() {
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		genDecl, ok := n.(*ast.GenDecl)
-		if ok && genDecl.Tok == token.CONST {
-			genDecl.Tok = token.VAR
-		}
-		return true
-	})
+func printAST(file *ast.File, fset *token.FileSet) (string, error) {
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 4}
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
 
-func (o *Obfuscator) obfuscateImports() {
-	if *noImports {
-		return
+// packageNameRe matches the package clause up to the end of the name.
+var packageNameRe = regexp.MustCompile(`(?m)^package\s+[\p{L}_][\p{L}\p{N}_]*`)
+
+// importOnPackageLine adds an import declaration of specs (separated by
+// semicolons) right after the package clause, on the same line so no line of
+// the file moves.
+func importOnPackageLine(content, specs string) string {
+	loc := packageNameRe.FindStringIndex(content)
+	if loc == nil {
+		return content
 	}
-	for _, decl := range o.file.Decls {
-		genDecl, ok := decl.(*ast.GenDecl)
-		if !ok || genDecl.Tok != token.IMPORT {
-			continue
-		}
-		for _, spec := range genDecl.Specs {
-			importSpec, ok := spec.(*ast.ImportSpec)
-			if !ok {
-				continue
+	return content[:loc[1]] + "; import (" + specs + ")" + content[loc[1]:]
+}
+
+// hideComments replaces every comment of the printed content with a short
+// placeholder, so the text passes can't mistake quotes or backticks inside
+// comments for literals. The returned replacer puts the comments back,
+// passed through rewrite when it is not nil.
+func hideComments(content string, rewrite func(string) string) (string, *strings.Replacer) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil || len(file.Comments) == 0 {
+		return content, strings.NewReplacer()
+	}
+	var out strings.Builder
+	var restore []string
+	last := 0
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			start := fset.Position(c.Pos()).Offset
+			end := fset.Position(c.End()).Offset
+			placeholder := fmt.Sprintf("/*goshield:%d*/", len(restore)/2)
+			out.WriteString(content[last:start])
+			out.WriteString(placeholder)
+			text := content[start:end]
+			if rewrite != nil {
+				text = rewrite(text)
 			}
-			path := strings.Trim(importSpec.Path.Value, `"`)
-			parts := strings.Split(path, "/")
-			baseName := parts[len(parts)-1]
-			alias := getObfuscatedName(baseName)
-			o.importAliases[baseName] = alias
-			importSpec.Name = &ast.Ident{Name: alias, NamePos: importSpec.Path.Pos()}
+			restore = append(restore, placeholder, text)
+			last = end
 		}
 	}
+	out.WriteString(content[last:])
+	return out.String(), strings.NewReplacer(restore...)
 }
 
-func (o *Obfuscator) updateImportReferences() {
-	if *noImports {
-		return
+// isDirective reports whether comment c is read by the toolchain: build
+// constraints, //line, //export, //extern and //tool:name pragmas such as
+// //go:embed. Their text must stay as written.
+func isDirective(c string) bool {
+	if constraint.IsGoBuild(c) || constraint.IsPlusBuild(c) {
+		return true
 	}
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		sel, ok := n.(*ast.SelectorExpr)
-		if !ok {
+	if strings.HasPrefix(c, "/*line ") {
+		return true
+	}
+	text, ok := strings.CutPrefix(c, "//")
+	if !ok {
+		return false
+	}
+	for _, prefix := range []string{"line ", "export ", "extern "} {
+		if strings.HasPrefix(text, prefix) {
 			return true
 		}
-		if ident, ok := sel.X.(*ast.Ident); ok {
-			if alias, exists := o.importAliases[ident.Name]; exists {
-				ident.Name = alias
-			}
-		}
-		return true
-	})
+	}
+	tool, _, ok := strings.Cut(text, ":")
+	return ok && tool != "" && strings.Trim(tool, "abcdefghijklmnopqrstuvwxyz0123456789") == ""
 }
 
-func (o *Obfuscator) obfuscateStructTypes() {
-	fieldNameSet := make(map[string]bool)
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		structType, ok := n.(*ast.StructType)
-		if !ok || structType.Fields == nil {
-			return true
-		}
-		for _, field := range structType.Fields.List {
-			for _, name := range field.Names {
-				fieldNameSet[name.Name] = true
-			}
+// garbleComment replaces the text of comment c with random letters and digits,
+// keeping its delimiters, whitespace and byte length. Directives are kept.
+func (e *textEncoder) garbleComment(c string) string {
+	if isDirective(c) {
+		return c
+	}
+	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	body, suffix := c[2:], ""
+	if strings.HasPrefix(c, "/*") {
+		body, suffix = c[2:len(c)-2], "*/"
+	}
+	garbled := []byte(body)
+	for i, b := range garbled {
+		if b != '\n' && b != '\r' && b != ' ' && b != '\t' {
+			garbled[i] = charset[e.rng.Intn(len(charset))]
 		}
-		return true
-	})
+	}
+	return c[:2] + string(garbled) + suffix
+}
 
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		ident, ok := n.(*ast.Ident)
-		if !ok {
-			return true
-		}
-		if fieldNameSet[ident.Name] {
+// keepsDirective reports whether comment c survives comment removal: a
+// //go:embed or //go:linkname line must still precede its declaration or the
+// package won't build, and //line directives set the positions reported by
+// the compiler and in stack traces. Build constraints are re-emitted by
+// fileHeader instead.
+func keepsDirective(c string) bool {
+	for _, prefix := range []string{"//go:embed ", "//go:linkname ", "//line ", "/*line "} {
+		if strings.HasPrefix(c, prefix) {
 			return true
 		}
-		if obfuscated, exists := structTypeMapping[ident.Name]; exists {
-			ident.Name = obfuscated
+	}
+	return false
+}
+
+// stripComments drops every comment of file except the directives the
+// toolchain needs, so the printer emits only those.
+func stripComments(file *ast.File) {
+	// Non-nil even when empty: with no comment list the printer falls back
+	// to the Doc and Comment fields of the nodes
+	groups := []*ast.CommentGroup{}
+	for _, group := range file.Comments {
+		var list []*ast.Comment
+		for _, c := range group.List {
+			if keepsDirective(c.Text) {
+				list = append(list, c)
+			}
 		}
-		if obfuscated, exists := typeAliasMapping[ident.Name]; exists {
-			ident.Name = obfuscated
+		if len(list) > 0 {
+			groups = append(groups, &ast.CommentGroup{List: list})
 		}
+	}
+	file.Comments = groups
+}
+
+// checkFileSize refuses an input over -max-file-size before it is parsed, so
+// a runaway file fails at once instead of exhausting memory in the passes.
+func (o *Obfuscator) checkFileSize(path string, src []byte) error {
+	if limit := o.opts.MaxFileSize << 20; o.opts.MaxFileSize != 0 && len(src) > limit {
+		return fmt.Errorf("%s is %.1f MB, over the %d MB limit (raise it with -max-file-size, or 0 for no limit)",
+			path, float64(len(src))/(1<<20), o.opts.MaxFileSize)
+	}
+	return nil
+}
+
+// copiedThrough reports whether src is written out unchanged instead of
+// being obfuscated: goshield's own output, generated files and cgo files.
+func (o *Obfuscator) copiedThrough(path string, src []byte) bool {
+	if !o.opts.Force && (isObfuscatedFile(src) || !o.opts.ObfuscateGenerated && isGeneratedFile(src)) {
 		return true
-	})
+	}
+	// the imports are enough to tell a cgo file
+	file, err := parser.ParseFile(token.NewFileSet(), path, src, parser.ImportsOnly)
+	return err == nil && isCgoFile(file)
 }
 
-func (o *Obfuscator) obfuscateVariables() {
-	if *noVars {
-		return
+func (o *Obfuscator) parseFile(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if list, ok := err.(scanner.ErrorList); ok {
+		return nil, newParseError(filename, src, list)
 	}
+	if err == nil && o.opts.Integrity {
+		o.markers[file] = integrityMarkers(file)
+	}
+	if err == nil && !o.opts.KeepComments && !o.opts.GarbleComments {
+		stripComments(file)
+	}
+	return file, err
+}
 
-	packageVars := make(map[string]bool)
-	for _, decl := range o.file.Decls {
-		genDecl, ok := decl.(*ast.GenDecl)
-		if !ok || genDecl.Tok != token.VAR {
-			continue
-		}
+// SyntaxError is a single syntax error together with the offending line.
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+	Text   string
+}
+
+// ParseError lists every syntax error found in an input file.
+type ParseError struct {
+	Filename string
+	Errors   []SyntaxError
+}
+
+func newParseError(filename string, src []byte, list scanner.ErrorList) *ParseError {
+	lines := strings.Split(string(src), "\n")
+	perr := &ParseError{Filename: filename}
+	for _, e := range list {
+		text := ""
+		if e.Pos.Line > 0 && e.Pos.Line <= len(lines) {
+			text = strings.TrimRight(lines[e.Pos.Line-1], "\r")
+		}
+		perr.Errors = append(perr.Errors, SyntaxError{
+			Line:   e.Pos.Line,
+			Column: e.Pos.Column,
+			Msg:    e.Msg,
+			Text:   text,
+		})
+	}
+	return perr
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	for i, se := range e.Errors {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s:%d:%d: %s", e.Filename, se.Line, se.Column, se.Msg)
+		if se.Text == "" {
+			continue
+		}
+		// Keep tabs in the caret line so it lines up with the source
+		caret := []rune{}
+		for j, r := range se.Text {
+			if j >= se.Column-1 {
+				break
+			}
+			if r != '\t' {
+				r = ' '
+			}
+			caret = append(caret, r)
+		}
+		fmt.Fprintf(&b, "\n    %5d | %s\n          | %s^", se.Line, se.Text, string(caret))
+	}
+	return b.String()
+}
+
+// ListGoFiles returns the .go files of dir. Test files are left out unless
+// includeTests is set; log hears about the ones skipped.
+func ListGoFiles(dir string, includeTests bool, log *Logger) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths, internal []string
+	skipped := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if !includeTests && strings.HasSuffix(entry.Name(), "_test.go") {
+			skipped++
+			// Tests in the package itself use its unexported names
+			file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+			if err == nil && !strings.HasSuffix(file.Name.Name, "_test") {
+				internal = append(internal, entry.Name())
+			}
+			continue
+		}
+		paths = append(paths, path)
+	}
+	if skipped > 0 {
+		log.Info("Skipped %d test files (use -include-tests to obfuscate them)", skipped)
+	}
+	if len(internal) > 0 {
+		log.Error("Skipped internal tests (%s) use the package's own names and won't build against the renamed code; use -include-tests to obfuscate them too",
+			strings.Join(internal, ", "))
+	}
+	return paths, nil
+}
+
+// InputFiles returns the files listed in Input, comma-separated as -i takes
+// them.
+func (o Options) InputFiles() []string {
+	return splitList(o.Input)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// PrepareOutputDir makes sure -o can hold several output files.
+func PrepareOutputDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("-o %s must be a directory when obfuscating multiple files", dir)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if strings.HasSuffix(dir, ".go") {
+		return fmt.Errorf("-o %s must be a directory when obfuscating multiple files", dir)
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+// tempOutput is where a worker writes path until the run succeeds.
+func tempOutput(path string) string {
+	return path + ".goshield-tmp"
+}
+
+// writeParts writes a rendered file to the temp file of its output, or with
+// -split to those of its parts.
+func writeParts(text string, paths []string) error {
+	texts := []string{text}
+	if len(paths) > 1 {
+		var err error
+		if texts, err = splitFile(text, paths); err != nil {
+			return err
+		}
+	}
+	for k, path := range paths {
+		if err := ioutil.WriteFile(tempOutput(path), []byte(markObfuscated(texts[k])), 0644); err != nil {
+			return fmt.Errorf("final write failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// removeTempOutputs deletes the temp files of a failed run.
+func removeTempOutputs(outputs []string) {
+	for _, path := range outputs {
+		if path != "-" {
+			os.Remove(tempOutput(path))
+		}
+	}
+}
+
+// commitOutputs moves the rendered files into place, prints those bound for
+// stdout ("-") and writes the copied-through files.
+func commitOutputs(outputs, texts, copies, copiesOut []string) error {
+	for i, path := range outputs {
+		if path == "-" {
+			if _, err := io.WriteString(os.Stdout, texts[i]); err != nil {
+				return fmt.Errorf("write failed: %v", err)
+			}
+			continue
+		}
+		if err := os.Rename(tempOutput(path), path); err != nil {
+			removeTempOutputs(outputs[i:])
+			return fmt.Errorf("final write failed: %v", err)
+		}
+	}
+	for i, path := range copiesOut {
+		if path == "-" {
+			if _, err := io.WriteString(os.Stdout, copies[i]); err != nil {
+				return fmt.Errorf("write failed: %v", err)
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(path, []byte(copies[i]), 0644); err != nil {
+			return fmt.Errorf("write failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// =============================================================================
+// GENERATED FILES
+// =============================================================================
+
+var generatedHeaderRe = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+var packageClauseRe = regexp.MustCompile(`(?m)^package\s`)
+
+// protocHeaderRe matches the header protoc plugins (protoc-gen-go,
+// protoc-gen-go-grpc) write.
+var protocHeaderRe = regexp.MustCompile(`(?m)^// Code generated by protoc-gen-`)
+
+// obfuscatedMarker is the last line of every file goshield writes, so a
+// later run can tell its own output from source.
+const obfuscatedMarker = "// goshield:obfuscated"
+
+// markObfuscated appends obfuscatedMarker to text. At the end it moves no
+// line, and it gets a line of its own even after -minify.
+func markObfuscated(text string) string {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text + obfuscatedMarker + "\n"
+}
+
+// isObfuscatedFile reports whether src is the output of an earlier run: its
+// last non-blank line is obfuscatedMarker. The same comment anywhere else,
+// such as in a doc example, is only a comment.
+func isObfuscatedFile(src []byte) bool {
+	src = bytes.TrimRight(src, " \t\r\n")
+	last := src[bytes.LastIndexByte(src, '\n')+1:]
+	return string(last) == obfuscatedMarker
+}
+
+// isGeneratedFile reports whether the standard generated-code header appears
+// before the package clause.
+func isGeneratedFile(src []byte) bool {
+	header := src
+	if loc := packageClauseRe.FindIndex(src); loc != nil {
+		header = src[:loc[0]]
+	}
+	return generatedHeaderRe.Match(header)
+}
+
+// isProtocFile reports whether src is a generated file written by protoc.
+func isProtocFile(src []byte) bool {
+	if loc := packageClauseRe.FindIndex(src); loc != nil {
+		src = src[:loc[0]]
+	}
+	return isGeneratedFile(src) && protocHeaderRe.Match(src)
+}
+
+// isCgoFile reports whether file uses cgo.
+func isCgoFile(file *ast.File) bool {
+	for _, imp := range file.Imports {
+		if imp.Path.Value == `"C"` {
+			return true
+		}
+	}
+	return false
+}
+
+// buildConstraints returns the //go:build and // +build lines from the file
+// header. They are comments, so the printer drops them with everything else.
+func buildConstraints(src []byte) []string {
+	header := src
+	if loc := packageClauseRe.FindIndex(src); loc != nil {
+		header = src[:loc[0]]
+	}
+	var lines []string
+	for _, line := range strings.Split(string(header), "\n") {
+		line = strings.TrimSpace(line)
+		if constraint.IsGoBuild(line) || constraint.IsPlusBuild(line) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// leadingComment returns the first comment block of the file verbatim, up to
+// the first blank line or code.
+func leadingComment(src []byte) string {
+	var block []string
+	inComment := false
+	for _, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inComment:
+			inComment = !strings.Contains(trimmed, "*/")
+		case strings.HasPrefix(trimmed, "//"):
+		case strings.HasPrefix(trimmed, "/*"):
+			inComment = !strings.Contains(trimmed[2:], "*/")
+		case trimmed == "" && len(block) == 0:
+			continue
+		default:
+			return strings.Join(block, "\n")
+		}
+		block = append(block, line)
+	}
+	return strings.Join(block, "\n")
+}
+
+// fileHeader returns the comments re-emitted above the package clause: the
+// leading comment block with -keep-header, then any build constraints it does
+// not already contain.
+func (o *Obfuscator) fileHeader(src []byte) string {
+	// The printer emits every comment itself
+	if o.opts.KeepComments || o.opts.GarbleComments {
+		return ""
+	}
+	var parts []string
+	kept := ""
+	if o.opts.KeepHeader {
+		kept = leadingComment(src)
+		if kept != "" {
+			parts = append(parts, kept)
+		}
+	}
+	var constraints []string
+	for _, line := range buildConstraints(src) {
+		if !strings.Contains(kept, line) {
+			constraints = append(constraints, line)
+		}
+	}
+	if len(constraints) > 0 {
+		parts = append(parts, strings.Join(constraints, "\n"))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	// Legacy constraints need a blank line before the package clause
+	return strings.Join(parts, "\n\n") + "\n\n"
+}
+
+// keepLinknames maps the local name of every //go:linkname directive to
+// itself: the directive names it, so renaming would break the link.
+func (o *Obfuscator) keepLinknames(file *ast.File) error {
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			fields := strings.Fields(c.Text)
+			if len(fields) < 2 || fields[0] != "//go:linkname" {
+				continue
+			}
+			if err := o.keepOriginal(c.Pos(), fields[1], "it is named by //go:linkname"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reflectLookups are the reflect methods that find a field or method by name.
+var reflectLookups = map[string]bool{"FieldByName": true, "MethodByName": true, "FieldByNameFunc": true}
+
+// keepReflectNames maps to themselves the names that reflection looks up:
+// string literals passed to FieldByName and MethodByName, and those inside
+// the function given to FieldByNameFunc. Names built at run time are not seen.
+func (o *Obfuscator) keepReflectNames(file *ast.File) error {
+	var err error
+	ast.Inspect(file, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || !reflectLookups[sel.Sel.Name] {
+			return true
+		}
+		ast.Inspect(call.Args[0], func(n ast.Node) bool {
+			if err != nil {
+				return false
+			}
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			name, unquoteErr := strconv.Unquote(lit.Value)
+			if unquoteErr != nil || !token.IsIdentifier(name) {
+				return true
+			}
+			o.log.Debug("Keeping %s: looked up by %s", name, sel.Sel.Name)
+			err = o.keepOriginal(lit.Pos(), name, "it is looked up by "+sel.Sel.Name)
+			return true
+		})
+		return true
+	})
+	return err
+}
+
+// keepOriginal maps name to itself. A -map-in map that renamed it already is
+// an error: the files of the earlier run use the new name, this one the old.
+func (o *Obfuscator) keepOriginal(pos token.Pos, name, reason string) error {
+	if existing, ok := o.nameMap[name]; ok && existing != name {
+		return o.errorf(pos, "%s was renamed to %s by an earlier run; %s", name, existing, reason)
+	}
+	o.nameMap[name] = name
+	return nil
+}
+
+// keepGeneratedNames maps every name declared by a generated file to itself so
+// the other files keep referencing it under its original name, and so do the
+// names it uses from them (stringer output calls the type it was run on).
+func (o *Obfuscator) keepGeneratedNames(file *ast.File) error {
+	var err error
+	keep := func(ident *ast.Ident) {
+		if ident == nil || ident.Name == "_" || err != nil {
+			return
+		}
+		err = o.keepOriginal(ident.Pos(), ident.Name, "obfuscate generated files first")
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			keep(d.Name)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					keep(sp.Name)
+				case *ast.ValueSpec:
+					for _, name := range sp.Names {
+						keep(name)
+					}
+				}
+			}
+		}
+	}
+	for _, ident := range file.Unresolved {
+		keep(ident)
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			keep(n.Sel)
+		case *ast.StructType:
+			if n.Fields == nil {
+				return true
+			}
+			for _, field := range n.Fields.List {
+				for _, name := range field.Names {
+					keep(name)
+				}
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// protobufMethods are methods protoc-gen-go declares on messages and enums;
+// a type that has one is handled by protobuf's reflection.
+var protobufMethods = map[string]bool{"ProtoReflect": true, "ProtoMessage": true, "EnumDescriptor": true}
+
+// protobufTagRe matches the struct tags of message fields and oneofs.
+var protobufTagRe = regexp.MustCompile(`\bprotobuf(_oneof)?:"`)
+
+// keepProtocNames keeps the field and method names of a protoc-generated file
+// that is obfuscated anyway (-obfuscate-generated): the protobuf runtime
+// finds fields such as unknownFields by name, and the methods implement its
+// interfaces and the gRPC service.
+func (o *Obfuscator) keepProtocNames(file *ast.File) error {
+	var err error
+	keep := func(ident *ast.Ident) {
+		if ident.Name == "_" || err != nil {
+			return
+		}
+		err = o.keepOriginal(ident.Pos(), ident.Name, "protobuf needs it unchanged")
+	}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil {
+			keep(fn.Name)
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if structType, ok := n.(*ast.StructType); ok && structType.Fields != nil {
+			for _, field := range structType.Fields.List {
+				for _, name := range field.Names {
+					keep(name)
+				}
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// =============================================================================
+// OBFUSCATOR STRUCT
+// =============================================================================
+
+// Obfuscator holds the state of one obfuscation run: the options and what
+// they compile to, the random source and rename map every file shares, and
+// what the passes learn about the files.
+type Obfuscator struct {
+	opts Options
+	log  *Logger
+	// rng drives every random choice, seeded so -seed reproduces a run
+	rng     *rand.Rand
+	nameMap map[string]string
+	// the compiled -keep-strings, -func-pattern and -type-pattern
+	// expressions, nil when unset
+	keepStrings, funcPattern, typePattern *regexp.Regexp
+	structTypeMapping                     map[string]string
+	typeAliasMapping                      map[string]string
+	// members declared by files of earlier -map-in runs
+	loadedMethods, loadedFields map[string]bool
+	stats                       Stats
+
+	files           []*ast.File
+	fset            *token.FileSet
+	declaredFuncs   map[string]bool
+	declaredMethods map[string]bool
+	importAliases   map[string]string
+	structFields    map[string]bool
+	typeNames       map[string]bool
+	typeSpecs       map[string]*ast.TypeSpec
+	structTypes     map[string]bool
+	fieldNames      map[string]string
+	globals         map[string]bool
+	ifaceMethods    map[string]bool
+	renamed         map[*ast.Ident]bool
+	// files copied through unchanged, type-checked with the others
+	copied []*ast.File
+	// what the type check resolved, shared by the passes; empty with
+	// -no-type-check
+	info     *types.Info
+	packages []*types.Package
+	tamper   *tamperGuard
+	// the identifiers of the files and the names reserved by reserveName,
+	// nil until it first runs
+	reserved map[string]bool
+	// the -integrity marker comments of each file, read before the
+	// comments are stripped
+	markers map[*ast.File][]*ast.Comment
+	// names declared in the input, its literals and switch statements,
+	// counted for -score
+	declNames                     map[string]bool
+	stringLits, intLits, switches int
+}
+
+// newObfuscator sets up a run with options, which must be valid. The files
+// are added by the parse stage.
+func newObfuscator(options Options) *Obfuscator {
+	log := &Logger{}
+	if options.Log != nil {
+		*log = *options.Log
+	}
+	log.verbose = options.Verbose
+	o := &Obfuscator{
+		opts:              options,
+		log:               log,
+		rng:               rand.New(rand.NewSource(1)),
+		nameMap:           make(map[string]string),
+		structTypeMapping: make(map[string]string),
+		typeAliasMapping:  make(map[string]string),
+		loadedMethods:     make(map[string]bool),
+		loadedFields:      make(map[string]bool),
+		fset:              token.NewFileSet(),
+		declaredFuncs:     make(map[string]bool),
+		declaredMethods:   make(map[string]bool),
+		importAliases:     make(map[string]string),
+		structFields:      make(map[string]bool),
+		typeNames:         make(map[string]bool),
+		typeSpecs:         make(map[string]*ast.TypeSpec),
+		structTypes:       make(map[string]bool),
+		fieldNames:        make(map[string]string),
+		globals:           make(map[string]bool),
+		ifaceMethods:      make(map[string]bool),
+		renamed:           make(map[*ast.Ident]bool),
+		markers:           make(map[*ast.File][]*ast.Comment),
+		info: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		},
+	}
+	if options.KeepStrings != "" {
+		o.keepStrings = regexp.MustCompile(options.KeepStrings)
+	}
+	if options.FuncPattern != "" {
+		o.funcPattern = regexp.MustCompile(options.FuncPattern)
+	}
+	if options.TypePattern != "" {
+		o.typePattern = regexp.MustCompile(options.TypePattern)
+	}
+	return o
+}
+
+// rename gives ident its obfuscated name exactly once, however many passes
+// reach it.
+func (o *Obfuscator) rename(ident *ast.Ident) {
+	if o.renamed[ident] {
+		return
+	}
+	o.renamed[ident] = true
+	ident.Name = o.getObfuscatedName(ident.Name)
+}
+
+// inspect walks every file handled by the obfuscator.
+func (o *Obfuscator) inspect(f func(ast.Node) bool) {
+	for _, file := range o.files {
+		ast.Inspect(file, f)
+	}
+}
+
+// errorf reports a problem found by a pass at pos, as file:line:col: message.
+func (o *Obfuscator) errorf(pos token.Pos, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", o.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+// =============================================================================
+// COLLECTION PASSES
+// =============================================================================
+
+func (o *Obfuscator) collectTypeNames() {
+	o.inspect(func(n ast.Node) bool {
+		if typeSpec, ok := n.(*ast.TypeSpec); ok {
+			o.typeNames[typeSpec.Name.Name] = true
+			o.typeSpecs[typeSpec.Name.Name] = typeSpec
+		}
+		return true
+	})
+}
+
+// collectGlobals records the package-level names declared by this run before
+// the passes rename them.
+func (o *Obfuscator) collectGlobals() {
+	for _, file := range o.files {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					o.globals[d.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch sp := spec.(type) {
+					case *ast.TypeSpec:
+						o.globals[sp.Name.Name] = true
+					case *ast.ValueSpec:
+						for _, name := range sp.Names {
+							o.globals[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// warnLibraryPackages warns about each package other than main whose exported
+// names are renamed: it doesn't build an executable, and code importing it
+// stops building. External test packages (x_test) are left out.
+func (o *Obfuscator) warnLibraryPackages() {
+	exported := make(map[string][]string)
+	var order []string
+	for _, file := range o.files {
+		name := file.Name.Name
+		if name == "main" || strings.HasSuffix(name, "_test") {
+			continue
+		}
+		if _, seen := exported[name]; !seen {
+			order = append(order, name)
+			exported[name] = nil
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Name.IsExported() {
+					exported[name] = append(exported[name], d.Name.Name)
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch sp := spec.(type) {
+					case *ast.TypeSpec:
+						if sp.Name.IsExported() {
+							exported[name] = append(exported[name], sp.Name.Name)
+						}
+					case *ast.ValueSpec:
+						for _, ident := range sp.Names {
+							if ident.IsExported() {
+								exported[name] = append(exported[name], ident.Name)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, name := range order {
+		if o.opts.RenamePackage {
+			o.log.Error("package %s is not main and -rename-package renames it: code importing it must use the new name", name)
+		}
+		names := exported[name]
+		if len(names) == 0 || o.keepName(names[0]) {
+			continue
+		}
+		o.log.Error("package %s is not main, so it builds no executable, and its exported names (%s) are renamed, "+
+			"which breaks code importing it; use -keep-exported to keep its API", name, strings.Join(firstNames(names, 3), ", "))
+	}
+}
+
+// firstNames returns at most n names, with "..." when some were left out.
+func firstNames(names []string, n int) []string {
+	if len(names) <= n {
+		return names
+	}
+	return append(names[:n:n], "...")
+}
+
+// renameKinds tells which kinds of declaration each renamed name was given,
+// read from the declaring identifiers of the renamed trees. Names are shared
+// across kinds, so a name declared as a func and elsewhere as a var is both.
+func (o *Obfuscator) renameKinds() map[string]map[string]bool {
+	originals := make(map[string]string)
+	for original, obfuscated := range o.nameMap {
+		if original != obfuscated {
+			originals[obfuscated] = original
+		}
+	}
+	kinds := make(map[string]map[string]bool)
+	add := func(ident *ast.Ident, kind string) {
+		if ident == nil {
+			return
+		}
+		if original, ok := originals[ident.Name]; ok {
+			if kinds[original] == nil {
+				kinds[original] = make(map[string]bool)
+			}
+			kinds[original][kind] = true
+		}
+	}
+	addFields := func(list *ast.FieldList, kind string) {
+		if list == nil {
+			return
+		}
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				add(name, kind)
+			}
+		}
+	}
+	for _, file := range o.files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.ImportSpec:
+				add(n.Name, "import")
+			case *ast.FuncDecl:
+				if n.Recv != nil {
+					add(n.Name, "method")
+					addFields(n.Recv, "var")
+				} else {
+					add(n.Name, "func")
+				}
+			case *ast.TypeSpec:
+				add(n.Name, "type")
+				addFields(n.TypeParams, "type")
+			case *ast.FuncType:
+				addFields(n.TypeParams, "type")
+				addFields(n.Params, "var")
+				addFields(n.Results, "var")
+			case *ast.StructType:
+				addFields(n.Fields, "field")
+			case *ast.InterfaceType:
+				addFields(n.Methods, "method")
+			case *ast.ValueSpec:
+				for _, name := range n.Names {
+					add(name, "var")
+				}
+			case *ast.AssignStmt:
+				if n.Tok == token.DEFINE {
+					for _, lhs := range n.Lhs {
+						if ident, ok := lhs.(*ast.Ident); ok {
+							add(ident, "var")
+						}
+					}
+				}
+			case *ast.RangeStmt:
+				if n.Tok == token.DEFINE {
+					for _, expr := range []ast.Expr{n.Key, n.Value} {
+						if ident, ok := expr.(*ast.Ident); ok {
+							add(ident, "var")
+						}
+					}
+				}
+			case *ast.LabeledStmt:
+				add(n.Label, "var")
+			}
+			return true
+		})
+	}
+	return kinds
+}
+
+// reservedDecls lists the declared functions, methods and package variables
+// that keep their names because they are in reservedNames.
+func (o *Obfuscator) reservedDecls() []string {
+	found := make(map[string]bool)
+	for _, file := range o.files {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if reservedNames[d.Name.Name] {
+					found[d.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if vs, ok := spec.(*ast.ValueSpec); ok {
+						for _, name := range vs.Names {
+							if reservedNames[name.Name] {
+								found[name.Name] = true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return sortedKeys(found)
+}
+
+func (o *Obfuscator) collectDeclaredFunctions() error {
+	var errs []error
+	for _, file := range o.files {
+		testFile := strings.HasSuffix(o.fset.Position(file.Pos()).Filename, "_test.go")
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			name := fn.Name.Name
+			// The runtime calls these by name
+			if name == "main" || name == "init" {
+				continue
+			}
+			// go test finds these by name, and go vet checks that an
+			// example names declared identifiers, which keep theirs too
+			if testFile && fn.Recv == nil && isTestFunc(name) {
+				o.nameMap[name] = name
+				for _, ref := range exampleNames(name) {
+					if err := o.keepOriginal(fn.Name.Pos(), ref, "example "+name+" refers to it"); err != nil {
+						errs = append(errs, err)
+					}
+				}
+				continue
+			}
+			if o.funcPattern != nil && !o.funcPattern.MatchString(name) {
+				continue
+			}
+			if fn.Recv == nil {
+				// One named like a builtin (min, max, clear) hides it in the
+				// whole package, so every call by that name is a call to it
+				o.declaredFuncs[name] = true
+			} else if !reservedNames[name] && !o.ifaceMethods[name] && !(o.opts.KeepExportedMethods && ast.IsExported(name)) {
+				o.declaredMethods[name] = true
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// typeCheck type-checks the files one package at a time, together with the
+// files copied through unchanged, and keeps what resolves in o.info. Errors
+// don't stop the check, whatever resolves still counts, but those in files
+// built for this platform are returned. Build variants of a file
+// (file_linux.go, file_windows.go) are checked together, their declarations
+// clash, so a package with variants is checked once more without the
+// variants built elsewhere to tell real errors apart.
+func (o *Obfuscator) typeCheck() error {
+	packages := make(map[string][]*ast.File)
+	var order []string
+	for _, file := range append(append([]*ast.File(nil), o.files...), o.copied...) {
+		if _, seen := packages[file.Name.Name]; !seen {
+			order = append(order, file.Name.Name)
+		}
+		packages[file.Name.Name] = append(packages[file.Name.Name], file)
+	}
+
+	var typeErrs []string
+	imp := importer.ForCompiler(o.fset, "source", nil)
+	for _, name := range order {
+		var errs []string
+		conf := types.Config{
+			Importer:    imp,
+			FakeImportC: true,
+			Error:       func(err error) { errs = append(errs, err.Error()) },
+		}
+		all := packages[name]
+		if pkg, _ := conf.Check(name, o.fset, all, o.info); pkg != nil {
+			o.packages = append(o.packages, pkg)
+		}
+		var built []*ast.File
+		for _, file := range all {
+			path := o.fset.Position(file.Package).Filename
+			if match, err := build.Default.MatchFile(filepath.Dir(path), filepath.Base(path)); err != nil || match {
+				built = append(built, file)
+			}
+		}
+		if len(built) < len(all) {
+			errs = nil
+			conf.Check(name, o.fset, built, nil)
+		}
+		typeErrs = append(typeErrs, errs...)
+	}
+
+	if len(typeErrs) == 0 {
+		return nil
+	}
+	const shown = 10
+	if len(typeErrs) > shown {
+		typeErrs = append(typeErrs[:shown], fmt.Sprintf("and %d more", len(typeErrs)-shown))
+	}
+	return fmt.Errorf("the input does not type-check (pass -skip-typecheck to obfuscate it anyway):\n%s", strings.Join(typeErrs, "\n"))
+}
+
+// collectInterfaceMethods records the methods some type needs to satisfy an
+// interface declared in its package or in one of the package's imports.
+// Such methods keep their names. Every build variant of a type counts, so
+// all of them keep the same methods.
+func (o *Obfuscator) collectInterfaceMethods() {
+	for _, pkg := range o.packages {
+		var ifaces []*types.Interface
+		addIface := func(t types.Type) {
+			if named, ok := t.(*types.Named); ok && named.TypeParams().Len() > 0 {
+				return
+			}
+			if iface, ok := t.Underlying().(*types.Interface); ok && iface.NumMethods() > 0 {
+				ifaces = append(ifaces, iface)
+			}
+		}
+		scopes := []*types.Scope{pkg.Scope()}
+		for _, imported := range pkg.Imports() {
+			scopes = append(scopes, imported.Scope())
+		}
+		for _, scope := range scopes {
+			for _, n := range scope.Names() {
+				if tn, ok := scope.Lookup(n).(*types.TypeName); ok {
+					addIface(tn.Type())
+				}
+			}
+		}
+		// Interface literals, e.g. parameters typed interface{ Read([]byte) (int, error) }
+		for expr, tv := range o.info.Types {
+			if _, ok := expr.(*ast.InterfaceType); ok && tv.Type != nil {
+				addIface(tv.Type)
+			}
+		}
+
+		for _, obj := range o.info.Defs {
+			tn, ok := obj.(*types.TypeName)
+			if !ok || tn.Pkg() != pkg || types.IsInterface(tn.Type()) {
+				continue
+			}
+			if named, ok := tn.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+				continue
+			}
+			for _, iface := range ifaces {
+				if !types.Implements(tn.Type(), iface) && !types.Implements(types.NewPointer(tn.Type()), iface) {
+					continue
+				}
+				for i := 0; i < iface.NumMethods(); i++ {
+					o.ifaceMethods[iface.Method(i).Name()] = true
+				}
+			}
+		}
+	}
+	if len(o.ifaceMethods) > 0 {
+		o.log.Debug("Interface methods kept: %s", strings.Join(sortedKeys(o.ifaceMethods), ", "))
+	}
+}
+
+// isTestFunc reports whether go test runs a function of a _test.go file by
+// its name: Test, Benchmark, Example or Fuzz, optionally followed by a suffix
+// that does not start with a lowercase letter.
+func isTestFunc(name string) bool {
+	for _, prefix := range []string{"Test", "Benchmark", "Example", "Fuzz"} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := name[len(prefix):]
+		if rest == "" {
+			return true
+		}
+		r, _ := utf8.DecodeRuneInString(rest)
+		return !unicode.IsLower(r)
+	}
+	return false
+}
+
+// exampleNames returns the identifiers an example function refers to, read
+// as go vet does: ExampleT_M_suffix names type T and its method M, a suffix
+// starts with a lowercase letter and Example_suffix names none.
+func exampleNames(name string) []string {
+	if !strings.HasPrefix(name, "Example") {
+		return nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(name, "Example"), "_", 3)
+	if parts[0] == "" {
+		return nil
+	}
+	names := []string{parts[0]}
+	if len(parts) > 1 && parts[1] != "" {
+		if r, _ := utf8.DecodeRuneInString(parts[1]); !unicode.IsLower(r) {
+			names = append(names, parts[1])
+		}
+	}
+	return names
+}
+
+// collectStructFields records the field names -fields renames. A field with
+// the name of a method promoted from an embedded type of its struct hides
+// that method, and renamed it would stop hiding it and change the method set,
+// so with -fields such a name keeps its spelling everywhere.
+func (o *Obfuscator) collectStructFields() error {
+	var errs []error
+	o.inspect(func(n ast.Node) bool {
+		structType, ok := n.(*ast.StructType)
+		if !ok || structType.Fields == nil {
+			return true
+		}
+		promoted := o.promotedMethods(structType)
+		for _, field := range structType.Fields.List {
+			for _, name := range field.Names {
+				if reservedNames[name.Name] {
+					continue
+				}
+				o.structFields[name.Name] = true
+				if o.opts.Fields && promoted[name.Name] {
+					o.log.Debug("Keeping field %s, it hides a method of an embedded type", name.Name)
+					if err := o.keepOriginal(name.Pos(), name.Name, "the field hides a method of an embedded type"); err != nil {
+						errs = append(errs, err)
+					}
+				}
+			}
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// keepProtobufTypes keeps the field and method names of the protobuf types
+// declared outside protoc output: types declaring a protobufMethods method or
+// a field with a protobuf tag, and, as far as the type check resolved them,
+// types embedding a generated message, as hand-edited copies do.
+func (o *Obfuscator) keepProtobufTypes() error {
+	methods := make(map[string][]*ast.Ident)
+	for _, file := range o.files {
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil && len(fn.Recv.List) > 0 {
+				recv := receiverName(fn.Recv)
+				methods[recv] = append(methods[recv], fn.Name)
+			}
+		}
+	}
+	var err error
+	keep := func(ident *ast.Ident) {
+		if ident.Name == "_" || err != nil {
+			return
+		}
+		err = o.keepOriginal(ident.Pos(), ident.Name, "protobuf needs it unchanged")
+	}
+	o.inspect(func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		structType, _ := spec.Type.(*ast.StructType)
+		if !o.isProtobufType(spec, structType, methods[spec.Name.Name]) {
+			return true
+		}
+		o.log.Debug("Keeping the field and method names of %s, a protobuf type", spec.Name.Name)
+		if structType != nil && structType.Fields != nil {
+			for _, field := range structType.Fields.List {
+				for _, name := range field.Names {
+					keep(name)
+				}
+			}
+		}
+		for _, name := range methods[spec.Name.Name] {
+			keep(name)
+		}
+		return true
+	})
+	return err
+}
+
+// isProtobufType reports whether protobuf handles the type spec declares;
+// methods holds the names of the methods declared on it.
+func (o *Obfuscator) isProtobufType(spec *ast.TypeSpec, structType *ast.StructType, methods []*ast.Ident) bool {
+	for _, name := range methods {
+		if protobufMethods[name.Name] {
+			return true
+		}
+	}
+	if structType != nil && structType.Fields != nil {
+		for _, field := range structType.Fields.List {
+			if field.Tag != nil && protobufTagRe.MatchString(field.Tag.Value) {
+				return true
+			}
+		}
+	}
+	obj, ok := o.info.Defs[spec.Name].(*types.TypeName)
+	if !ok {
+		return false
+	}
+	ptr := types.NewPointer(obj.Type())
+	for name := range protobufMethods {
+		if method, _, _ := types.LookupFieldOrMethod(ptr, true, obj.Pkg(), name); method != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// promotedMethods returns the names of the methods the embedded fields of
+// structType bring in, as far as the type check resolved them.
+func (o *Obfuscator) promotedMethods(structType *ast.StructType) map[string]bool {
+	names := make(map[string]bool)
+	for _, field := range structType.Fields.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		typ := o.info.TypeOf(field.Type)
+		if typ == nil {
+			continue
+		}
+		for _, t := range []types.Type{typ, types.NewPointer(typ)} {
+			methods := types.NewMethodSet(t)
+			for i := 0; i < methods.Len(); i++ {
+				names[methods.At(i).Obj().Name()] = true
+			}
+		}
+	}
+	return names
+}
+
+func (o *Obfuscator) collectStructTypes() {
+	o.inspect(func(n ast.Node) bool {
+		typeSpec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		originalName := typeSpec.Name.Name
+		// Types -type-pattern leaves out map to themselves, so the other
+		// passes still know them for types
+		obfuscatedName := originalName
+		if o.typePattern == nil || o.typePattern.MatchString(originalName) {
+			obfuscatedName = o.getObfuscatedName(originalName)
+		}
+		if _, isStruct := typeSpec.Type.(*ast.StructType); isStruct {
+			o.structTypes[originalName] = true
+			o.structTypeMapping[originalName] = obfuscatedName
+		} else {
+			o.typeAliasMapping[originalName] = obfuscatedName
+		}
+		return true
+	})
+}
+
+// =============================================================================
+// OBFUSCATION PASSES
+// =============================================================================
+
+// obfuscateConsts turns package-level const declarations into vars, so their
+// strings can go through the runtime decoders. Blocks using iota or leaving
+// out values first get the values the type checker computed written out. A
+// block stays const when it can't be a var: one of its names is needed as a
+// constant, or its values can't be written out. Constants that stay const
+// are still renamed by the vars pass, and the text passes give their values
+// constant encodings.
+func (o *Obfuscator) obfuscateConsts() error {
+	if o.opts.NoConsts {
+		return nil
+	}
+	needed := o.constantOperands()
+	for _, file := range o.files {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.CONST || o.keepsConstNames(genDecl) {
+				continue
+			}
+			if name := declaresAny(genDecl, needed); name != "" {
+				o.log.Debug("Keeping the const block of %s, it is used as a constant", name)
+				continue
+			}
+			if pos := constOnlyPos(genDecl); pos.IsValid() && !o.materializeConsts(genDecl) {
+				o.log.Debug("%s: keeping the const block, its values can't be written out", o.fset.Position(pos))
+				continue
+			}
+			genDecl.Tok = token.VAR
+		}
+	}
+	return nil
+}
+
+// materializeConsts replaces the iota expressions and left out values of a
+// const block with the integers and strings they evaluate to, repeating the
+// type a left out value implies, so the block means the same as a var. It
+// needs the type check, so it changes nothing under -no-type-check, nor
+// when a value can't be written out.
+func (o *Obfuscator) materializeConsts(genDecl *ast.GenDecl) bool {
+	if o.opts.NoTypeCheck {
+		return false
+	}
+	typeExprs := make([]ast.Expr, len(genDecl.Specs))
+	values := make([][]ast.Expr, len(genDecl.Specs))
+	var lastType ast.Expr
+	for i, spec := range genDecl.Specs {
+		vs := spec.(*ast.ValueSpec)
+		implicit := len(vs.Values) == 0
+		if !implicit {
+			lastType = vs.Type
+			if !specConstOnlyPos(vs).IsValid() {
+				continue
+			}
+		}
+		typ := vs.Type
+		if implicit && lastType != nil {
+			if typ = copyTypeName(lastType, vs.Names[0].End()); typ == nil {
+				return false
+			}
+		}
+		for _, name := range vs.Names {
+			c, ok := o.info.Defs[name].(*types.Const)
+			if !ok {
+				return false
+			}
+			// Untyped values become the default type of their literal
+			if typ == nil && c.Type() != types.Typ[types.UntypedInt] && c.Type() != types.Typ[types.UntypedString] {
+				return false
+			}
+			value := constLiteral(c.Val(), name.End())
+			if value == nil {
+				return false
+			}
+			values[i] = append(values[i], value)
+		}
+		typeExprs[i] = typ
+	}
+	for i, spec := range genDecl.Specs {
+		if values[i] != nil {
+			vs := spec.(*ast.ValueSpec)
+			vs.Type, vs.Values = typeExprs[i], values[i]
+		}
+	}
+	return true
+}
+
+// constLiteral spells an integer or string constant as a literal at pos, or
+// returns nil for other kinds and integers beyond int64.
+func constLiteral(val constant.Value, pos token.Pos) ast.Expr {
+	switch val.Kind() {
+	case constant.String:
+		return &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: strconv.Quote(constant.StringVal(val))}
+	case constant.Int:
+		n, exact := constant.Int64Val(val)
+		if !exact {
+			return nil
+		}
+		if n < 0 {
+			return &ast.UnaryExpr{OpPos: pos, Op: token.SUB, X: &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: strconv.FormatUint(-uint64(n), 10)}}
+		}
+		return &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: strconv.FormatInt(n, 10)}
+	}
+	return nil
+}
+
+// copyTypeName copies a type name (T or pkg.T) at pos, keeping the object the
+// renaming passes resolve it by, or returns nil for other type expressions.
+func copyTypeName(expr ast.Expr, pos token.Pos) ast.Expr {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return &ast.Ident{NamePos: pos, Name: t.Name, Obj: t.Obj}
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok {
+			return &ast.SelectorExpr{X: &ast.Ident{NamePos: pos, Name: x.Name, Obj: x.Obj}, Sel: &ast.Ident{NamePos: pos, Name: t.Sel.Name}}
+		}
+	}
+	return nil
+}
+
+// constantOperands returns the names used where Go requires a constant:
+// array lengths, keys of array and slice literals and the values of const
+// declarations, and with the type check the untyped constants converted to
+// another type where they are used (var b byte = n), which as vars would be
+// of their default type. Matching is by name, so a local variable sharing a
+// constant's name keeps it const too.
+func (o *Obfuscator) constantOperands() map[string]bool {
+	names := make(map[string]bool)
+	addNames := func(expr ast.Expr) {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				names[ident.Name] = true
+			}
+			return true
+		})
+	}
+	o.inspect(func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.ArrayType:
+			if node.Len != nil {
+				addNames(node.Len)
+			}
+		case *ast.CompositeLit:
+			if !o.indexedLiteral(node) {
+				return true
+			}
+			for _, elt := range node.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					addNames(kv.Key)
+				}
+			}
+		case *ast.GenDecl:
+			if node.Tok != token.CONST {
+				return true
+			}
+			for _, spec := range node.Specs {
+				if vs, ok := spec.(*ast.ValueSpec); ok {
+					for _, value := range vs.Values {
+						addNames(value)
+					}
+				}
+			}
+		}
+		return true
+	})
+	for name := range o.convertedConsts() {
+		names[name] = true
+	}
+	return names
+}
+
+// convertedConsts returns the untyped constants whose value takes another
+// type than their default one where they are used (var b byte = n + 1,
+// n * time.Second); explicit conversions, comparisons and shift counts
+// take a var as well. It needs the type check, which records the final type
+// of a constant expression on the whole expression, not on its operands;
+// under -no-type-check it finds none.
+func (o *Obfuscator) convertedConsts() map[string]bool {
+	names := make(map[string]bool)
+	if o.opts.NoTypeCheck {
+		return names
+	}
+	parents := make(map[ast.Node]ast.Node)
+	var stack []ast.Node
+	o.inspect(func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		if len(stack) > 0 {
+			parents[n] = stack[len(stack)-1]
+		}
+		stack = append(stack, n)
+		return true
+	})
+	for ident, obj := range o.info.Uses {
+		c, ok := obj.(*types.Const)
+		if !ok || !isUntyped(c.Type()) {
+			continue
+		}
+		var expr ast.Expr = ident
+		for expr != nil {
+			parent := parents[expr]
+			if call, ok := parent.(*ast.CallExpr); ok && o.info.Types[call.Fun].IsType() {
+				break
+			}
+			typ := o.info.Types[expr].Type
+			if typ == nil {
+				break
+			}
+			if !isUntyped(typ) {
+				if !types.Identical(typ, types.Default(c.Type())) {
+					names[c.Name()] = true
+				}
+				break
+			}
+			expr = nil
+			switch p := parent.(type) {
+			case *ast.ParenExpr, *ast.UnaryExpr:
+				expr = p.(ast.Expr)
+			case *ast.BinaryExpr:
+				comparison := p.Op == token.EQL || p.Op == token.NEQ || p.Op == token.LSS ||
+					p.Op == token.LEQ || p.Op == token.GTR || p.Op == token.GEQ
+				shiftCount := (p.Op == token.SHL || p.Op == token.SHR) && p.Y == expr
+				if !comparison && !shiftCount {
+					expr = p
+				}
+			}
+		}
+	}
+	return names
+}
+
+// isUntyped reports whether typ is the type of an untyped constant.
+func isUntyped(typ types.Type) bool {
+	basic, ok := typ.(*types.Basic)
+	return ok && basic.Info()&types.IsUntyped != 0
+}
+
+// indexedLiteral reports whether lit is an array or slice literal, whose
+// keys must be constants.
+func (o *Obfuscator) indexedLiteral(lit *ast.CompositeLit) bool {
+	if tv, ok := o.info.Types[lit]; ok {
+		switch tv.Type.Underlying().(type) {
+		case *types.Array, *types.Slice:
+			return true
+		}
+		return false
+	}
+	isStruct, keyType, elemType := o.literalShape(lit.Type, 0)
+	return !isStruct && keyType == nil && elemType != nil
+}
+
+// declaresAny returns the first name of genDecl found in names, or "".
+func declaresAny(genDecl *ast.GenDecl, names map[string]bool) string {
+	for _, spec := range genDecl.Specs {
+		if vs, ok := spec.(*ast.ValueSpec); ok {
+			for _, name := range vs.Names {
+				if names[name.Name] {
+					return name.Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// constOnlyPos returns the position of the first spec that only makes sense
+// in a const block: one using iota or leaving out its values.
+func constOnlyPos(genDecl *ast.GenDecl) token.Pos {
+	for _, spec := range genDecl.Specs {
+		if vs, ok := spec.(*ast.ValueSpec); ok {
+			if pos := specConstOnlyPos(vs); pos.IsValid() {
+				return pos
+			}
+		}
+	}
+	return token.NoPos
+}
+
+// specConstOnlyPos is constOnlyPos for a single spec.
+func specConstOnlyPos(vs *ast.ValueSpec) token.Pos {
+	if len(vs.Values) == 0 {
+		return vs.Pos()
+	}
+	pos := token.NoPos
+	for _, value := range vs.Values {
+		ast.Inspect(value, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && ident.Name == "iota" && ident.Obj == nil && !pos.IsValid() {
+				pos = ident.Pos()
+			}
+			return !pos.IsValid()
+		})
+	}
+	return pos
+}
+
+// keepsConstNames reports whether a const declaration defines a name that
+// keeps its spelling; turning it into a var would change the public API.
+func (o *Obfuscator) keepsConstNames(genDecl *ast.GenDecl) bool {
+	for _, spec := range genDecl.Specs {
+		if vs, ok := spec.(*ast.ValueSpec); ok {
+			for _, name := range vs.Names {
+				if o.keepName(name.Name) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// obfuscatePackageName gives the files of a library package one new package
+// name. An external test package (foo_test next to foo) goes with the package
+// it tests and gets the new name with _test appended.
+func (o *Obfuscator) obfuscatePackageName() error {
+	if !o.opts.RenamePackage {
+		return nil
+	}
+	first := o.files[0]
+	for _, file := range o.files[1:] {
+		if o.testedPackage(file) != o.testedPackage(first) {
+			return o.errorf(file.Name.Pos(), "package %s differs from package %s of %s", file.Name.Name,
+				first.Name.Name, o.fset.Position(first.Name.Pos()).Filename)
+		}
+	}
+	for _, file := range o.files {
+		name := o.testedPackage(file)
+		// Executables must stay in package main
+		if name == "main" {
+			continue
+		}
+		if name != file.Name.Name {
+			file.Name.Name = o.getObfuscatedName(name) + "_test"
+		} else {
+			file.Name.Name = o.getObfuscatedName(name)
+		}
+	}
+	return nil
+}
+
+// testedPackage returns the package name of file, without the _test suffix
+// of an external test package.
+func (o *Obfuscator) testedPackage(file *ast.File) string {
+	if strings.HasSuffix(o.fset.Position(file.Package).Filename, "_test.go") {
+		return strings.TrimSuffix(file.Name.Name, "_test")
+	}
+	return file.Name.Name
+}
+
+// obfuscateImports aliases every import except those listed by -keep-imports.
+// References are renamed by name, so an import sharing its local name with a
+// kept one (text/template and html/template in two files) is kept too.
+func (o *Obfuscator) obfuscateImports() error {
+	if o.opts.NoImports {
+		return nil
+	}
+	keep := make(map[string]bool)
+	for _, path := range splitList(o.opts.KeepImports) {
+		keep[path] = true
+	}
+	kept := make(map[string]bool)
+	for _, file := range o.files {
+		for _, importSpec := range file.Imports {
+			if keep[strings.Trim(importSpec.Path.Value, `"`)] {
+				kept[importName(importSpec)] = true
+			}
+		}
+	}
+
+	for _, file := range o.files {
+		for _, importSpec := range file.Imports {
+			baseName := importName(importSpec)
+			// Blank and dot imports have no name to hide
+			if baseName == "_" || baseName == "." || kept[baseName] {
+				continue
+			}
+			alias := o.getObfuscatedName(baseName)
+			o.importAliases[baseName] = alias
+			importSpec.Name = &ast.Ident{Name: alias, NamePos: importSpec.Path.Pos()}
+		}
+	}
+	return nil
+}
+
+// importName is the name an import is referred to by: its alias, or else the
+// last element of its path.
+func importName(importSpec *ast.ImportSpec) string {
+	if importSpec.Name != nil {
+		return importSpec.Name.Name
+	}
+	path := strings.Trim(importSpec.Path.Value, `"`)
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+func (o *Obfuscator) updateImportReferences() error {
+	if o.opts.NoImports {
+		return nil
+	}
+	o.inspect(func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			if alias, exists := o.importAliases[ident.Name]; exists {
+				ident.Name = alias
+			}
+		}
+		return true
+	})
+	return nil
+}
+
+// obfuscateFields renames struct fields together with the keys of struct
+// composite literals and field selectors. Matching is by name, so fields
+// sharing a name with members of imported types are renamed too.
+func (o *Obfuscator) obfuscateFields() error {
+	if !o.opts.Fields {
+		return nil
+	}
+	var tagKeys []string
+	for _, key := range strings.Split(o.opts.FieldTags, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			tagKeys = append(tagKeys, key)
+		}
+	}
+	var errs []error
+	pkgNames := o.packageNames()
+	o.inspect(func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.StructType:
+			if node.Fields == nil {
+				return true
+			}
+			for _, field := range node.Fields.List {
+				if err := o.tagField(field, tagKeys); err != nil {
+					errs = append(errs, err)
+				}
+				for _, name := range field.Names {
+					if o.renamesField(name.Name) {
+						o.rename(name)
+					}
+				}
+			}
+		case *ast.SelectorExpr:
+			if !isPackageSelector(node, pkgNames) && o.renamesField(node.Sel.Name) && o.isFieldSelector(node) {
+				o.rename(node.Sel)
+			}
+		case *ast.CompositeLit:
+			// Map and slice keys are ordinary expressions left to the other passes
+			o.visitLiteralKeys(node, nil, func(key *ast.Ident, isStruct, known bool) {
+				if isStruct && o.renamesField(key.Name) {
+					o.rename(key)
+				}
+			})
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// renamesField reports whether -fields renames the fields called name;
+// -keep-exported-fields keeps the exported ones and so the encoded names.
+func (o *Obfuscator) renamesField(name string) bool {
+	return o.structFields[name] && !(o.opts.KeepExportedFields && ast.IsExported(name))
+}
+
+// isFieldSelector reports whether sel selects a field rather than a method
+// sharing a field's name (an embedded interface's Close next to a Close func
+// field elsewhere). Without the type check's answer it is taken for a field.
+func (o *Obfuscator) isFieldSelector(sel *ast.SelectorExpr) bool {
+	if selection, ok := o.info.Selections[sel]; ok {
+		return selection.Kind() == types.FieldVal
+	}
+	return true
+}
+
+// tagField gives an exported field about to be renamed a tag entry for each
+// of keys that names it, so encoders reading that tag still see the original
+// name. Entries that already name the field are left alone.
+func (o *Obfuscator) tagField(field *ast.Field, keys []string) error {
+	if len(keys) == 0 || len(field.Names) == 0 {
+		return nil
+	}
+	name := field.Names[0].Name
+	if !ast.IsExported(name) || !o.renamesField(name) || o.keepName(name) {
+		return nil
+	}
+	// One tag can't name several fields, those stay untagged
+	if len(field.Names) > 1 {
+		o.log.Error("%s: fields %s share one tag, declare them separately to keep their encoded names",
+			o.fset.Position(field.Pos()), name)
+		return nil
+	}
+	tag := ""
+	if field.Tag != nil {
+		var err error
+		if tag, err = strconv.Unquote(field.Tag.Value); err != nil {
+			return o.errorf(field.Tag.Pos(), "bad struct tag %s", field.Tag.Value)
+		}
+	}
+	pairs, ok := parseStructTag(tag)
+	if !ok {
+		return o.errorf(field.Tag.Pos(), "cannot parse struct tag %s", field.Tag.Value)
+	}
+	for _, key := range keys {
+		found := false
+		for i := range pairs {
+			if pairs[i][0] != key {
+				continue
+			}
+			found = true
+			tagName, options, _ := strings.Cut(pairs[i][1], ",")
+			if tagName == "" && !tagIgnoresName(options) {
+				pairs[i][1] = name + pairs[i][1]
+			}
+		}
+		if !found {
+			pairs = append(pairs, [2]string{key, name})
+		}
+	}
+	parts := make([]string, len(pairs))
+	for i, pair := range pairs {
+		parts[i] = pair[0] + ":" + strconv.Quote(pair[1])
+	}
+	tag = strings.Join(parts, " ")
+	pos := field.Type.End()
+	if field.Tag != nil {
+		pos = field.Tag.Pos()
+	}
+	value := "`" + tag + "`"
+	if strings.Contains(tag, "`") {
+		value = strconv.Quote(tag)
+	}
+	field.Tag = &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: value}
+	return nil
+}
+
+// tagIgnoresName reports whether tag options make the name part meaningless,
+// as in xml:",chardata" or mapstructure:",squash".
+func tagIgnoresName(options string) bool {
+	for _, option := range strings.Split(options, ",") {
+		switch option {
+		case "chardata", "innerxml", "comment", "any", "squash", "remain", "inline":
+			return true
+		}
+	}
+	return false
+}
+
+// parseStructTag splits a struct tag into its key/value pairs, in order,
+// following the conventional format reflect.StructTag reads.
+func parseStructTag(tag string) ([][2]string, bool) {
+	var pairs [][2]string
+	for {
+		tag = strings.TrimLeft(tag, " ")
+		if tag == "" {
+			return pairs, true
+		}
+		i := 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			return nil, false
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return nil, false
+		}
+		value, err := strconv.Unquote(tag[:i+1])
+		if err != nil {
+			return nil, false
+		}
+		pairs = append(pairs, [2]string{key, value})
+		tag = tag[i+1:]
+	}
+}
+
+// visitLiteralKeys calls visit for every identifier key of lit and of the
+// literals nested in it. isStruct tells whether the key names a struct field
+// and known whether the literal type could be resolved at all; typ carries
+// the element type into nested literals that elide it.
+func (o *Obfuscator) visitLiteralKeys(lit *ast.CompositeLit, typ ast.Expr, visit func(key *ast.Ident, isStruct, known bool)) {
+	if lit.Type != nil {
+		typ = lit.Type
+	}
+	isStruct, keyType, elemType := o.literalShape(typ, 0)
+	known := isStruct || elemType != nil
+	for _, elt := range lit.Elts {
+		value := elt
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			if key, ok := kv.Key.(*ast.Ident); ok {
+				visit(key, isStruct, known)
+			}
+			if inner, ok := kv.Key.(*ast.CompositeLit); ok && !isStruct {
+				o.visitLiteralKeys(inner, keyType, visit)
+			}
+			value = kv.Value
+		}
+		if inner, ok := value.(*ast.CompositeLit); ok && !isStruct {
+			o.visitLiteralKeys(inner, elemType, visit)
+		}
+	}
+}
+
+// literalShape resolves typ through local type declarations and reports
+// whether it is a struct, or else its key and element types.
+func (o *Obfuscator) literalShape(typ ast.Expr, depth int) (isStruct bool, keyType, elemType ast.Expr) {
+	if depth > 10 {
+		return false, nil, nil
+	}
+	switch t := typ.(type) {
+	case *ast.StarExpr:
+		return o.literalShape(t.X, depth+1)
+	case *ast.ParenExpr:
+		return o.literalShape(t.X, depth+1)
+	case *ast.IndexExpr:
+		return o.literalShape(t.X, depth+1)
+	case *ast.IndexListExpr:
+		return o.literalShape(t.X, depth+1)
+	case *ast.StructType:
+		return true, nil, nil
+	case *ast.ArrayType:
+		return false, nil, t.Elt
+	case *ast.MapType:
+		return false, t.Key, t.Value
+	case *ast.Ident:
+		if spec, ok := o.typeSpecs[t.Name]; ok {
+			return o.literalShape(spec.Type, depth+1)
+		}
+	}
+	return false, nil, nil
+}
+
+// packageNames returns the local names imports are referenced by.
+func (o *Obfuscator) packageNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, file := range o.files {
+		for _, spec := range file.Imports {
+			names[importName(spec)] = true
+		}
+	}
+	return names
+}
+
+// isPackageSelector reports whether sel is a qualified identifier (pkg.Name).
+func isPackageSelector(sel *ast.SelectorExpr, pkgNames map[string]bool) bool {
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Obj == nil && pkgNames[x.Name]
+}
+
+func (o *Obfuscator) obfuscateStructTypes() error {
+	// Plain fields keep their names even when a type shares them, while an
+	// embedded field is named after its type and must follow its rename
+	plainFields := make(map[string]bool)
+	embeddedFields := make(map[string]bool)
+	fieldIdents := make(map[*ast.Ident]bool)
+	o.inspect(func(n ast.Node) bool {
+		structType, ok := n.(*ast.StructType)
+		if !ok || structType.Fields == nil {
+			return true
+		}
+		for _, field := range structType.Fields.List {
+			// An embedded imported type (io.Reader) names a field that
+			// never changes, just like a plain field
+			if len(field.Names) == 0 && isImportedType(field.Type) {
+				plainFields[embeddedFieldName(field.Type)] = true
+			} else if len(field.Names) == 0 {
+				embeddedFields[embeddedFieldName(field.Type)] = true
+			}
+			for _, name := range field.Names {
+				plainFields[name.Name] = true
+				fieldIdents[name] = true
+			}
+		}
+		return true
+	})
+	isPlainField := func(ident *ast.Ident) bool {
+		return plainFields[ident.Name] && !embeddedFields[ident.Name]
+	}
+
+	// The selected name of pkg.Type (e.g. io.Reader in a type assertion or a
+	// type switch case) never refers to a local type, and neither do field
+	// selectors and struct literal keys naming a plain field
+	pkgNames := o.packageNames()
+	o.inspect(func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.SelectorExpr:
+			if isPackageSelector(node, pkgNames) || isPlainField(node.Sel) {
+				fieldIdents[node.Sel] = true
+			}
+		case *ast.CompositeLit:
+			for _, elt := range node.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok && isPlainField(key) {
+						fieldIdents[key] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	o.inspect(func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || fieldIdents[ident] {
+			return true
+		}
+		// A name used both as a plain field and as an embedded type cannot
+		// be told apart in selectors, so the type keeps its name
+		if plainFields[ident.Name] && embeddedFields[ident.Name] {
+			return true
+		}
+		// Variables and parameters sharing a type's name resolve to a
+		// non-type object and belong to the variable pass
+		if ident.Obj != nil && ident.Obj.Kind != ast.Typ {
+			return true
+		}
+		if obfuscated, exists := o.structTypeMapping[ident.Name]; exists {
+			ident.Name = obfuscated
+		}
+		if obfuscated, exists := o.typeAliasMapping[ident.Name]; exists {
+			ident.Name = obfuscated
+		}
+		return true
+	})
+	return nil
+}
+
+// isImportedType reports whether an embedded field type is package-qualified.
+func isImportedType(typ ast.Expr) bool {
+	switch t := typ.(type) {
+	case *ast.StarExpr:
+		return isImportedType(t.X)
+	case *ast.IndexExpr:
+		return isImportedType(t.X)
+	case *ast.IndexListExpr:
+		return isImportedType(t.X)
+	case *ast.SelectorExpr:
+		return true
+	}
+	return false
+}
+
+// embeddedFieldName returns the implicit field name of an embedded type.
+func embeddedFieldName(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return embeddedFieldName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedFieldName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedFieldName(t.X)
+	}
+	return ""
+}
+
+func (o *Obfuscator) obfuscateVariables() error {
+	if o.opts.NoVars {
+		return nil
+	}
+
+	packageVars := make(map[string]bool)
+	for _, file := range o.files {
+		for _, decl := range file.Decls {
+			// Package consts that stay const are renamed the same way
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || (genDecl.Tok != token.VAR && genDecl.Tok != token.CONST) {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				valueSpec, ok := spec.(*ast.ValueSpec)
+				if !ok {
+					continue
+				}
+				for _, name := range valueSpec.Names {
+					if name.Name != "_" && !reservedNames[name.Name] {
+						packageVars[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	o.inspect(func(n ast.Node) bool {
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			o.renameParams(fn.Recv, fn.Type, fn.Body)
+		case *ast.FuncLit:
+			o.renameParams(nil, fn.Type, fn.Body)
+		}
+		return true
+	})
+
+	o.inspect(func(n ast.Node) bool {
+		if typeSwitch, ok := n.(*ast.TypeSwitchStmt); ok {
+			o.renameTypeSwitchBinding(typeSwitch)
+			return true
+		}
+		ident, ok := n.(*ast.Ident)
+		if !ok || o.renamed[ident] {
+			return true
+		}
+		if reservedNames[ident.Name] || o.structFields[ident.Name] {
+			return true
+		}
+		if ident.Obj != nil && (ident.Obj.Kind == ast.Var || ident.Obj.Kind == ast.Con) && ident.Name != "_" {
+			o.rename(ident)
+			return true
+		}
+		if _, isTypeAlias := o.typeAliasMapping[ident.Name]; isTypeAlias || o.structTypes[ident.Name] {
+			return true
+		}
+		if packageVars[ident.Name] {
+			o.rename(ident)
+		}
+		return true
+	})
+	return nil
+}
+
+// renameParams renames the receiver (recv may be nil), parameters and named
+// results of a function and every reference to them, matched by object so a
+// parameter sharing a struct field's name is still renamed without touching
+// the field.
+func (o *Obfuscator) renameParams(recv *ast.FieldList, fnType *ast.FuncType, body *ast.BlockStmt) {
+	objects := make(map[*ast.Object]bool)
+	for _, list := range []*ast.FieldList{recv, fnType.Params, fnType.Results} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				if name.Name == "_" || reservedNames[name.Name] || name.Obj == nil {
+					continue
+				}
+				objects[name.Obj] = true
+				o.rename(name)
+			}
+		}
+	}
+	if len(objects) == 0 || body == nil {
+		return
+	}
+
+	// The parser also resolves struct literal keys to a parameter of the same
+	// name; those keys are field names and must stay
+	fieldKeys := make(map[*ast.Ident]bool)
+	valueKeys := make(map[*ast.Ident]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.CompositeLit); ok {
+			o.visitLiteralKeys(lit, nil, func(key *ast.Ident, isStruct, known bool) {
+				if known && !isStruct {
+					valueKeys[key] = true
+				} else {
+					fieldKeys[key] = true
+				}
+			})
+		}
+		return true
+	})
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || !objects[ident.Obj] {
+			return true
+		}
+		if fieldKeys[ident] && !valueKeys[ident] {
+			return true
+		}
+		o.rename(ident)
+		return true
+	})
+}
+
+// renameTypeSwitchBinding renames v in `switch v := x.(type)` together with
+// its uses in every case body, where it is implicitly redeclared per case.
+func (o *Obfuscator) renameTypeSwitchBinding(typeSwitch *ast.TypeSwitchStmt) {
+	assign, ok := typeSwitch.Assign.(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 1 {
+		return
+	}
+	bound, ok := assign.Lhs[0].(*ast.Ident)
+	if !ok || bound.Name == "_" || reservedNames[bound.Name] {
+		return
+	}
+	o.rename(bound)
+	for _, stmt := range typeSwitch.Body.List {
+		clause, ok := stmt.(*ast.CaseClause)
+		if !ok {
+			continue
+		}
+		for _, bodyStmt := range clause.Body {
+			ast.Inspect(bodyStmt, func(n ast.Node) bool {
+				ident, ok := n.(*ast.Ident)
+				if ok && ident.Obj != nil && ident.Obj.Decl == assign {
+					o.rename(ident)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func (o *Obfuscator) obfuscateFunctions() error {
+	if o.opts.NoFunctions {
+		return nil
+	}
+
+	o.inspect(func(n ast.Node) bool {
+		fn, ok := n.(*ast.FuncDecl)
+		if !ok {
+			return true
+		}
+		name := fn.Name.Name
+		if o.declaredFuncs[name] || o.declaredMethods[name] {
+			fn.Name.Name = o.getObfuscatedName(name)
+		}
+		return true
+	})
+
+	o.inspect(func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := call.Fun.(*ast.Ident); ok {
+			if o.declaredFuncs[ident.Name] {
+				ident.Name = o.getObfuscatedName(ident.Name)
+			}
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+			if o.isMethodSelector(sel, true) {
+				sel.Sel.Name = o.getObfuscatedName(sel.Sel.Name)
+			}
+		}
+		return true
+	})
+
+	// Method values (w.run) and method expressions ((*T).run) not called
+	o.inspect(func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if o.isMethodSelector(sel, false) {
+			sel.Sel.Name = o.getObfuscatedName(sel.Sel.Name)
+		}
+		return true
+	})
+
+	// Functions used as values: apply(double), g := double. References
+	// to another file are unresolved, so any such name that isn't a
+	// selector, method, label, field or local declaration counts.
+	notFuncs := make(map[*ast.Ident]bool)
+	o.inspect(func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			notFuncs[n.Sel] = true
+		case *ast.FuncDecl:
+			notFuncs[n.Name] = true
+		case *ast.BranchStmt:
+			notFuncs[n.Label] = true
+		}
+		return true
+	})
+	o.inspect(func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || notFuncs[ident] || !o.declaredFuncs[ident.Name] || o.structFields[ident.Name] {
+			return true
+		}
+		if ident.Obj != nil {
+			if fn, ok := ident.Obj.Decl.(*ast.FuncDecl); !ok || fn.Recv != nil {
+				return true
+			}
+		}
+		ident.Name = o.getObfuscatedName(ident.Name)
+		return true
+	})
+	return nil
+}
+
+// isMethodSelector reports whether sel names one of the renamed methods.
+// A method may share its name with a field of another type, so the type
+// check decides; without its answer a called selector is taken for a
+// method and any other for a field.
+func (o *Obfuscator) isMethodSelector(sel *ast.SelectorExpr, called bool) bool {
+	if !o.declaredMethods[sel.Sel.Name] {
+		return false
+	}
+	if selection, ok := o.info.Selections[sel]; ok {
+		return selection.Kind() != types.FieldVal
+	}
+	return called || !o.structFields[sel.Sel.Name]
+}
+
+// obfuscateLabels renames statement labels and the break/continue/goto
+// references to them. Labels live in their own namespace, so sharing a name
+// with a variable is harmless.
+func (o *Obfuscator) obfuscateLabels() error {
+	if o.opts.NoLabels {
+		return nil
+	}
+	o.inspect(func(n ast.Node) bool {
+		switch stmt := n.(type) {
+		case *ast.LabeledStmt:
+			o.rename(stmt.Label)
+		case *ast.BranchStmt:
+			if stmt.Label != nil {
+				o.rename(stmt.Label)
+			}
+		}
+		return true
+	})
+	return nil
+}
+
+// timeUnits are the time constants a duration count is multiplied by
+var timeUnits = map[string]bool{
+	"Nanosecond": true, "Microsecond": true, "Millisecond": true,
+	"Second": true, "Minute": true, "Hour": true,
+}
+
+// durationOperand returns the integer literal counting a duration in
+// 5 * time.Second, time.Second * 5 or time.Duration(5), or nil. timeNames
+// are the names the time package is imported under.
+func durationOperand(expr ast.Expr, timeNames map[string]bool) *ast.BasicLit {
+	isTime := func(x ast.Expr, names map[string]bool) bool {
+		sel, ok := x.(*ast.SelectorExpr)
+		if !ok {
+			return false
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		return ok && timeNames[pkg.Name] && names[sel.Sel.Name]
+	}
+	intLit := func(x ast.Expr) *ast.BasicLit {
+		if lit, ok := x.(*ast.BasicLit); ok && lit.Kind == token.INT {
+			return lit
+		}
+		return nil
+	}
+	switch x := expr.(type) {
+	case *ast.BinaryExpr:
+		if x.Op != token.MUL {
+			return nil
+		}
+		if isTime(x.Y, timeUnits) {
+			return intLit(x.X)
+		}
+		if isTime(x.X, timeUnits) {
+			return intLit(x.Y)
+		}
+	case *ast.CallExpr:
+		if len(x.Args) == 1 && isTime(x.Fun, map[string]bool{"Duration": true}) {
+			return intLit(x.Args[0])
+		}
+	}
+	return nil
+}
+
+// importNames returns the names path is imported under across the files,
+// after any renaming of import aliases.
+func (o *Obfuscator) importNames(path string) map[string]bool {
+	names := make(map[string]bool)
+	for _, file := range o.files {
+		for _, spec := range file.Imports {
+			if strings.Trim(spec.Path.Value, `"`) == path {
+				names[importName(spec)] = true
+			}
+		}
+	}
+	return names
+}
+
+// lowerSwitches rewrites expression switches as if/else chains over a
+// temporary holding the tag, so the tag is still evaluated once and the cases
+// in order. Labeled switches and those with an unlabeled break of their own
+// are left alone: an if has nothing to break out of.
+func (o *Obfuscator) lowerSwitches() error {
+	if !o.opts.SwitchToIf {
+		return nil
+	}
+	count := 0
+	lower := func(list []ast.Stmt) {
+		for i, stmt := range list {
+			if sw, ok := stmt.(*ast.SwitchStmt); ok && !breaksSwitch(sw) && judgeable(sw) {
+				list[i] = o.lowerSwitch(sw)
+				count++
+			}
+		}
+	}
+	// Lowered bodies are visited after their switch, so nested switches
+	// are lowered too
+	o.inspectSelected(func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.BlockStmt:
+			lower(x.List)
+		case *ast.CaseClause:
+			lower(x.Body)
+		case *ast.CommClause:
+			lower(x.Body)
+		}
+		return true
+	})
+	o.stats.Switches += count
+	if count > 0 {
+		o.log.Info("Switch statements: %d", count)
+	}
+	return nil
+}
+
+// breaksSwitch reports whether a clause of sw has an unlabeled break that
+// leaves sw itself.
+func breaksSwitch(sw *ast.SwitchStmt) bool {
+	found := false
+	for _, clause := range sw.Body.List {
+		ast.Inspect(clause, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt, *ast.FuncLit:
+				return false
+			case *ast.BranchStmt:
+				if x.Tok == token.BREAK && x.Label == nil {
+					found = true
+				}
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// judgeable reports whether lowerSwitch can tell if sw is a terminating
+// statement, which a function may end with. That only matters with both
+// fallthrough and default: the else-chain form terminates exactly when the
+// switch did.
+func judgeable(sw *ast.SwitchStmt) bool {
+	if !switchFallsThrough(sw) || !hasDefault(sw) {
+		return true
+	}
+	for _, stmt := range sw.Body.List {
+		if _, known := clauseTerminates(stmt.(*ast.CaseClause)); !known {
+			return false
+		}
+	}
+	return true
+}
+
+// clauseTerminates reports whether a clause ends in a terminating statement
+// or fallthrough. known is false for endings it doesn't judge: loops,
+// labeled statements and nested switches or selects.
+func clauseTerminates(clause *ast.CaseClause) (ends, known bool) {
+	if fallsThrough(clause) {
+		return true, true
+	}
+	if len(clause.Body) == 0 {
+		return false, true
+	}
+	return terminates(clause.Body[len(clause.Body)-1])
+}
+
+// terminates judges one statement for clauseTerminates.
+func terminates(stmt ast.Stmt) (bool, bool) {
+	switch s := stmt.(type) {
+	case *ast.ReturnStmt:
+		return true, true
+	case *ast.BranchStmt:
+		return s.Tok == token.GOTO, true
+	case *ast.ExprStmt:
+		call, ok := s.X.(*ast.CallExpr)
+		if !ok {
+			return false, true
+		}
+		fn, ok := call.Fun.(*ast.Ident)
+		return ok && fn.Name == "panic", true
+	case *ast.BlockStmt:
+		if len(s.List) == 0 {
+			return false, true
+		}
+		return terminates(s.List[len(s.List)-1])
+	case *ast.IfStmt:
+		if s.Else == nil {
+			return false, true
+		}
+		body, known := terminates(s.Body)
+		if !known {
+			return false, false
+		}
+		els, known := terminates(s.Else)
+		return body && els, known
+	case *ast.ForStmt, *ast.LabeledStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		return false, false
+	}
+	return false, true
+}
+
+func switchFallsThrough(sw *ast.SwitchStmt) bool {
+	for _, stmt := range sw.Body.List {
+		if fallsThrough(stmt.(*ast.CaseClause)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDefault(sw *ast.SwitchStmt) bool {
+	for _, stmt := range sw.Body.List {
+		if stmt.(*ast.CaseClause).List == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerSwitch returns the block replacing sw:
+//
+//	{ init; t := tag; if t == a || t == b { ... } else if t == c { ... } else { default } }
+//
+// With fallthrough the chain only picks a clause number, and each clause body
+// follows as its own if, fallthrough setting the number of the next clause.
+// Those ifs don't terminate, so a terminating switch gets an unreachable
+// panic after them. New nodes take the positions of the code they stand
+// for, so the printer keeps each case on its line.
+func (o *Obfuscator) lowerSwitch(sw *ast.SwitchStmt) *ast.BlockStmt {
+	block := &ast.BlockStmt{Lbrace: sw.Switch, Rbrace: sw.Body.Rbrace}
+	if sw.Init != nil {
+		block.List = append(block.List, sw.Init)
+	}
+	tag := ""
+	if sw.Tag != nil {
+		tag = randomName(o.rng, o.opts.NameLen)
+		block.List = append(block.List, assignStmt(tag, token.DEFINE, sw.Tag, sw.Tag.Pos()))
+	}
+
+	var clauses []*ast.CaseClause
+	for _, stmt := range sw.Body.List {
+		clauses = append(clauses, stmt.(*ast.CaseClause))
+	}
+	index := ""
+	if switchFallsThrough(sw) {
+		index = randomName(o.rng, o.opts.NameLen)
+	}
+	if index != "" {
+		block.List = append(block.List, assignStmt(index, token.DEFINE, intLit(0, sw.Body.Lbrace), sw.Body.Lbrace))
+	}
+	// body is what the chain runs for clause i
+	body := func(i int) *ast.BlockStmt {
+		clause := clauses[i]
+		if index != "" {
+			return &ast.BlockStmt{Lbrace: clause.Colon, List: []ast.Stmt{
+				assignStmt(index, token.ASSIGN, intLit(i+1, clause.Colon), clause.Colon),
+			}, Rbrace: clause.Colon}
+		}
+		return &ast.BlockStmt{Lbrace: clause.Colon, List: clause.Body, Rbrace: clause.End()}
+	}
+
+	var chain ast.Stmt
+	for i, clause := range clauses {
+		if clause.List == nil {
+			chain = body(i)
+		}
+	}
+	hasCases := false
+	for i := len(clauses) - 1; i >= 0; i-- {
+		if clauses[i].List == nil {
+			continue
+		}
+		hasCases = true
+		chain = &ast.IfStmt{If: clauses[i].Case, Cond: o.caseCond(tag, clauses[i].List), Body: body(i), Else: chain}
+	}
+	if chain != nil {
+		block.List = append(block.List, chain)
+	}
+	if tag != "" && !hasCases {
+		block.List = append(block.List, assignStmt("_", token.ASSIGN, &ast.Ident{Name: tag, NamePos: sw.Tag.Pos()}, sw.Tag.Pos()))
+	}
+
+	if index != "" {
+		for i, clause := range clauses {
+			stmts := clause.Body
+			if fallsThrough(clause) {
+				n := len(stmts)
+				stmts = append(stmts[:n-1:n-1], assignStmt(index, token.ASSIGN, intLit(i+2, stmts[n-1].Pos()), stmts[n-1].Pos()))
+			}
+			block.List = append(block.List, &ast.IfStmt{
+				If: clause.Case,
+				Cond: &ast.BinaryExpr{
+					X:     &ast.Ident{Name: index, NamePos: clause.Case},
+					OpPos: clause.Case,
+					Op:    token.EQL,
+					Y:     intLit(i+1, clause.Case),
+				},
+				Body: &ast.BlockStmt{Lbrace: clause.Colon, List: stmts, Rbrace: clause.End()},
+			})
+		}
+		if hasDefault(sw) && allTerminate(clauses) {
+			end := sw.Body.Rbrace
+			block.List = append(block.List, &ast.ExprStmt{X: &ast.CallExpr{
+				Fun:    &ast.Ident{Name: "panic", NamePos: end},
+				Lparen: end,
+				Args:   []ast.Expr{&ast.BasicLit{ValuePos: end, Kind: token.STRING, Value: `"unreachable"`}},
+				Rparen: end,
+			}})
+		}
+	}
+	return block
+}
+
+func allTerminate(clauses []*ast.CaseClause) bool {
+	for _, clause := range clauses {
+		if ok, _ := clauseTerminates(clause); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// fallsThrough reports whether a case clause ends in fallthrough.
+func fallsThrough(clause *ast.CaseClause) bool {
+	if len(clause.Body) == 0 {
+		return false
+	}
+	branch, ok := clause.Body[len(clause.Body)-1].(*ast.BranchStmt)
+	return ok && branch.Tok == token.FALLTHROUGH
+}
+
+// caseCond joins the expressions of a case with ||, comparing each with the
+// tag variable when the switch has one.
+func (o *Obfuscator) caseCond(tag string, list []ast.Expr) ast.Expr {
+	var cond ast.Expr
+	for _, x := range list {
+		pos := x.Pos()
+		x = parenthesize(x)
+		if tag != "" {
+			t := &ast.Ident{Name: tag, NamePos: pos}
+			switch o.rng.Intn(3) {
+			case 0:
+				x = &ast.BinaryExpr{X: t, OpPos: pos, Op: token.EQL, Y: x}
+			case 1:
+				x = &ast.BinaryExpr{X: x, OpPos: pos, Op: token.EQL, Y: t}
+			default:
+				x = &ast.UnaryExpr{OpPos: pos, Op: token.NOT, X: &ast.ParenExpr{
+					Lparen: pos,
+					X:      &ast.BinaryExpr{X: t, OpPos: pos, Op: token.NEQ, Y: x},
+					Rparen: x.End(),
+				}}
+			}
+		}
+		if cond == nil {
+			cond = x
+		} else {
+			cond = &ast.BinaryExpr{X: cond, OpPos: pos, Op: token.LOR, Y: x}
+		}
+	}
+	return cond
+}
+
+// parenthesize wraps x in parentheses unless it is an operand already.
+func parenthesize(x ast.Expr) ast.Expr {
+	switch x.(type) {
+	case *ast.Ident, *ast.BasicLit, *ast.CallExpr, *ast.SelectorExpr, *ast.IndexExpr, *ast.ParenExpr:
+		return x
+	}
+	return &ast.ParenExpr{Lparen: x.Pos(), X: x, Rparen: x.End()}
+}
+
+// assignStmt returns name = value, or name := value, at pos.
+func assignStmt(name string, tok token.Token, value ast.Expr, pos token.Pos) ast.Stmt {
+	return &ast.AssignStmt{Lhs: []ast.Expr{&ast.Ident{Name: name, NamePos: pos}}, TokPos: pos, Tok: tok, Rhs: []ast.Expr{value}}
+}
+
+func intLit(n int, pos token.Pos) *ast.BasicLit {
+	return &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: strconv.Itoa(n)}
+}
+
+// obfuscateIntegers rewrites integer literals in place. Every transform is a
+// constant expression, so the result stays valid wherever a literal was, and
+// ParseInt with base 0 understands 0x/0o/0b prefixes and digit separators.
+func (o *Obfuscator) obfuscateIntegers() error {
+	if o.opts.NoInts {
+		return nil
+	}
+	count := 0
+	var errs []error
+	arrayLens := make(map[*ast.BasicLit]bool)
+	constLits := make(map[*ast.BasicLit]bool)
+	durations := make(map[*ast.BasicLit]bool)
+	byteElems := make(map[*ast.BasicLit]bool)
+	timeNames := o.importNames("time")
+	o.inspectSelected(func(n ast.Node) bool {
+		// Array lengths are part of the type, keep them readable constants;
+		// make sizes and indexes take any int expression and are transformed
+		if array, ok := n.(*ast.ArrayType); ok && array.Len != nil {
+			ast.Inspect(array.Len, func(n ast.Node) bool {
+				if lit, ok := n.(*ast.BasicLit); ok {
+					arrayLens[lit] = true
+				}
+				return true
+			})
+			return true
+		}
+		if decl, ok := n.(*ast.GenDecl); ok && decl.Tok == token.CONST {
+			ast.Inspect(decl, func(n ast.Node) bool {
+				if lit, ok := n.(*ast.BasicLit); ok {
+					constLits[lit] = true
+				}
+				return true
+			})
+		}
+		if expr, ok := n.(ast.Expr); ok {
+			if lit := durationOperand(expr, timeNames); lit != nil && !constLits[lit] {
+				durations[lit] = true
+			}
+		}
+		// Byte and rune slices spell out text or magic numbers, so their
+		// elements are transformed however small, characters included
+		if composite, ok := n.(*ast.CompositeLit); ok && o.isByteLiteral(composite) {
+			for _, elt := range composite.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					elt = kv.Value
+				}
+				if lit, ok := elt.(*ast.BasicLit); ok {
+					byteElems[lit] = true
+				}
+			}
+		}
+		lit, ok := n.(*ast.BasicLit)
+		if !ok || arrayLens[lit] || (lit.Kind != token.INT && (lit.Kind != token.CHAR || !byteElems[lit])) {
+			return true
+		}
+		var value int64
+		if lit.Kind == token.CHAR {
+			value, _ = constant.Int64Val(constant.MakeFromLiteral(lit.Value, token.CHAR, 0))
+		} else if v, err := strconv.ParseInt(lit.Value, 0, 64); err != nil {
+			// Literals beyond int64 are valid Go, they are just left alone
+			if !errors.Is(err, strconv.ErrRange) {
+				errs = append(errs, o.errorf(lit.Pos(), "cannot parse integer literal %s", lit.Value))
+			}
+			return true
+		} else {
+			value = v
+		}
+		// The count of a duration is what tells 5 * time.Second apart, so
+		// it is transformed however small
+		if (value < o.opts.IntMin && !durations[lit] && !byteElems[lit]) || value > o.opts.IntMax {
+			return true
+		}
+		if o.opts.Poly {
+			lit.Value = o.polyInteger(value, 3)
+		} else {
+			lit.Value = o.obfuscateInteger(value)
+		}
+		count++
+		return true
+	})
+	o.stats.Integers += count
+	if count > 0 {
+		o.log.Info("Integer literals: %d", count)
+	}
+	return errors.Join(errs...)
+}
+
+// isByteLiteral reports whether lit is a slice or array literal of bytes or
+// runes, by the type check or else by its written type.
+func (o *Obfuscator) isByteLiteral(lit *ast.CompositeLit) bool {
+	if tv, ok := o.info.Types[lit]; ok {
+		var elem types.Type
+		switch t := tv.Type.Underlying().(type) {
+		case *types.Slice:
+			elem = t.Elem()
+		case *types.Array:
+			elem = t.Elem()
+		default:
+			return false
+		}
+		basic, ok := elem.Underlying().(*types.Basic)
+		return ok && (basic.Kind() == types.Uint8 || basic.Kind() == types.Int32)
+	}
+	array, ok := lit.Type.(*ast.ArrayType)
+	if !ok {
+		return false
+	}
+	elem, ok := array.Elt.(*ast.Ident)
+	return ok && (elem.Name == "byte" || elem.Name == "rune" || elem.Name == "uint8" || elem.Name == "int32")
+}
+
+// =============================================================================
+// NAME MAP FILES
+// =============================================================================
+
+// nameMapFile is the -map-in/-map-out layout. Besides the names it records
+// the methods (and, with -fields, the fields) the obfuscated files declared,
+// so later runs can rename selectors that reach them.
+type nameMapFile struct {
+	Names   map[string]string `json:"names"`
+	Methods []string          `json:"methods"`
+	Fields  []string          `json:"fields,omitempty"`
+}
+
+// readNameMap reads a -map-out file and checks that no two names share an
+// obfuscated name.
+func readNameMap(path string) (*nameMapFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var saved nameMapFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("name map %s: %v", path, err)
+	}
+	owners := make(map[string]string)
+	for original, obfuscated := range saved.Names {
+		if other, taken := owners[obfuscated]; taken {
+			return nil, fmt.Errorf("name map %s: %s and %s both map to %s", path, other, original, obfuscated)
+		}
+		owners[obfuscated] = original
+	}
+	return &saved, nil
+}
+
+// loadNameMap adds the mappings saved by an earlier -map-out run to nameMap.
+func (o *Obfuscator) loadNameMap(path string) error {
+	saved, err := readNameMap(path)
+	if os.IsNotExist(err) {
+		// The first run of an incremental build starts the map
+		o.log.Info("Name map %s does not exist yet, starting a new one", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read name map: %v", err)
+	}
+	for original, obfuscated := range saved.Names {
+		o.nameMap[original] = obfuscated
+	}
+	for _, name := range saved.Methods {
+		o.loadedMethods[name] = true
+	}
+	for _, name := range saved.Fields {
+		o.loadedFields[name] = true
+	}
+	o.log.Info("Loaded %d names from %s", len(saved.Names), path)
+	return nil
+}
+
+// saveNameMap writes every mapping and member known after the run, loaded
+// ones included.
+func (o *Obfuscator) saveNameMap(path string) error {
+	methods := make(map[string]bool)
+	for name := range o.loadedMethods {
+		methods[name] = true
+	}
+	for name := range o.declaredMethods {
+		methods[name] = true
+	}
+	fields := make(map[string]bool)
+	for name := range o.loadedFields {
+		fields[name] = true
+	}
+	if o.opts.Fields {
+		for name := range o.structFields {
+			if o.renamesField(name) {
+				fields[name] = true
+			}
+		}
+	}
+
+	saved := nameMapFile{
+		Names:   o.nameMap,
+		Methods: sortedKeys(methods),
+		Fields:  sortedKeys(fields),
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("write name map: %v", err)
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// renameExternalRefs renames references to declarations that live in files
+// obfuscated by other runs. An identifier that resolves to nothing in this
+// run, is not predeclared and is not an import must be declared elsewhere in
+// the package; it takes its name from the shared map, or reserves one for the
+// file that declares it later. Selectors and literal keys follow the methods
+// and fields recorded by earlier runs.
+func (o *Obfuscator) renameExternalRefs() error {
+	if o.opts.MapIn == "" && o.opts.MapOut == "" {
+		return nil
+	}
+
+	assigned := make(map[string]bool)
+	for _, obfuscated := range o.nameMap {
+		assigned[obfuscated] = true
+	}
+	loaded := func(ident *ast.Ident) {
+		if obfuscated, ok := o.nameMap[ident.Name]; ok {
+			ident.Name = obfuscated
+		}
+	}
+	pkgNames := o.packageNames()
+	skip := make(map[*ast.Ident]bool)
+	for _, file := range o.files {
+		skip[file.Name] = true
+	}
+
+	o.inspect(func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.FuncDecl:
+			skip[node.Name] = true
+		case *ast.LabeledStmt:
+			skip[node.Label] = true
+		case *ast.BranchStmt:
+			if node.Label != nil {
+				skip[node.Label] = true
+			}
+		case *ast.SelectorExpr:
+			skip[node.Sel] = true
+			name := node.Sel.Name
+			if !isPackageSelector(node, pkgNames) && (o.loadedMethods[name] || o.loadedFields[name]) && !o.structFields[name] {
+				loaded(node.Sel)
+			}
+		case *ast.KeyValueExpr:
+			if key, ok := node.Key.(*ast.Ident); ok && key.Obj == nil {
+				skip[key] = true
+				if o.loadedFields[key.Name] && !o.structFields[key.Name] {
+					loaded(key)
+				}
+			}
+		case *ast.Ident:
+			name := node.Name
+			if node.Obj != nil || skip[node] || name == "_" || assigned[name] ||
+				o.globals[name] || pkgNames[name] || types.Universe.Lookup(name) != nil {
+				return true
+			}
+			node.Name = o.getObfuscatedName(name)
+			assigned[node.Name] = true
+		}
+		return true
+	})
+	return nil
+}
+
+// =============================================================================
+// DEOBFUSCATION
+// =============================================================================
+
+// Deobfuscate copies r to w, turning every obfuscated identifier of the
+// -map-out file mapFile back into its original name. Stack traces, logs and
+// panics all work as the text is only split into identifier-like words.
+func Deobfuscate(r io.Reader, w io.Writer, mapFile string) error {
+	saved, err := readNameMap(mapFile)
+	if err != nil {
+		return err
+	}
+	originals := make(map[string]string)
+	for original, obfuscated := range saved.Names {
+		if original != obfuscated {
+			originals[obfuscated] = original
+		}
+	}
+
+	in := bufio.NewReader(r)
+	out := bufio.NewWriter(w)
+	var word strings.Builder
+	flush := func() {
+		if word.Len() == 0 {
+			return
+		}
+		if original, ok := originals[word.String()]; ok {
+			out.WriteString(original)
+		} else {
+			out.WriteString(word.String())
+		}
+		word.Reset()
+	}
+	for {
+		c, _, err := in.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+			word.WriteRune(c)
+			continue
+		}
+		flush()
+		out.WriteRune(c)
+	}
+	flush()
+	return out.Flush()
+}
+
+// =============================================================================
+// WATERMARK
+// =============================================================================
+
+// watermarkMagic starts every decoded watermark so extraction can tell it
+// from other byte slices.
+const watermarkMagic = "gsWM"
+
+const watermarkKeyLen = 8
+
+// injectWatermark appends opts.Watermark to content as a byte slice named
+// e.watermark: a random key followed by the magic and the text xor-ed with
+// it. An init function assigns the slice so the linker keeps its bytes in
+// the binary.
+func (e *textEncoder) injectWatermark(content string) string {
+	payload := []byte(watermarkMagic + e.opts.Watermark)
+	key := e.randomBytes(watermarkKeyLen)
+	for i := range payload {
+		payload[i] ^= key[i%len(key)]
+	}
+	name := e.watermark
+	return content + "\nvar " + name + " = []byte{" + byteList(append(key, payload...)) + "}\n" +
+		"\nfunc init() { " + name + " = " + name + "[:len(" + name + "):len(" + name + ")] }\n"
+}
+
+// randomBytes returns n bytes drawn from the encoder's random source.
+func (e *textEncoder) randomBytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(e.rng.Intn(256))
+	}
+	return b
+}
+
+// byteList formats b as the elements of a byte slice literal.
+func byteList(b []byte) string {
+	elems := make([]string, len(b))
+	for i, c := range b {
+		elems[i] = strconv.Itoa(int(c))
+	}
+	return strings.Join(elems, ", ")
+}
+
+// ExtractWatermarks returns the watermarks found in the package-level byte
+// slices of an obfuscated file.
+func ExtractWatermarks(filename string, src []byte) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
 		for _, spec := range genDecl.Specs {
-			valueSpec, ok := spec.(*ast.ValueSpec)
-			if !ok {
+			vs, ok := spec.(*ast.ValueSpec)
+			if !ok || len(vs.Values) != 1 {
+				continue
+			}
+			lit, ok := vs.Values[0].(*ast.CompositeLit)
+			if !ok || len(lit.Elts) < watermarkKeyLen+len(watermarkMagic) {
 				continue
 			}
-			for _, name := range valueSpec.Names {
-				if name.Name != "_" && !reservedNames[name.Name] {
-					packageVars[name.Name] = true
+			data := make([]byte, 0, len(lit.Elts))
+			for _, elt := range lit.Elts {
+				basic, ok := elt.(*ast.BasicLit)
+				if !ok || basic.Kind != token.INT {
+					break
+				}
+				n, err := strconv.ParseUint(basic.Value, 0, 8)
+				if err != nil {
+					break
 				}
+				data = append(data, byte(n))
+			}
+			if len(data) != len(lit.Elts) {
+				continue
+			}
+			key, payload := data[:watermarkKeyLen], data[watermarkKeyLen:]
+			for i := range payload {
+				payload[i] ^= key[i%len(key)]
+			}
+			if text, ok := strings.CutPrefix(string(payload), watermarkMagic); ok {
+				found = append(found, text)
 			}
 		}
 	}
+	return found, nil
+}
 
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		ident, ok := n.(*ast.Ident)
-		if !ok {
-			return true
+// =============================================================================
+// TAMPER CHECK
+// =============================================================================
+
+// tamperGuard holds what -tamper-check and -integrity hash: the
+// package-level string constants of the first file, or of the marked
+// regions. Identifiers are kept rather than names so the guard uses the
+// names they end up with.
+type tamperGuard struct {
+	consts  []*ast.Ident
+	data    []byte
+	handler *ast.Ident
+	// the import names of crypto/sha256 and, without a handler, os
+	sha, os string
+}
+
+// addConsts records the string constants decl declares, once each.
+func (g *tamperGuard) addConsts(decl ast.Decl) {
+	genDecl, ok := decl.(*ast.GenDecl)
+	if !ok || genDecl.Tok != token.CONST {
+		return
+	}
+	for _, spec := range genDecl.Specs {
+		vs := spec.(*ast.ValueSpec)
+		for i, name := range vs.Names {
+			if i >= len(vs.Values) || name.Name == "_" {
+				continue
+			}
+			lit, ok := vs.Values[i].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				continue
+			}
+			value, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				continue
+			}
+			guarded := false
+			for _, ident := range g.consts {
+				guarded = guarded || ident == name
+			}
+			if !guarded {
+				g.consts = append(g.consts, name)
+				g.data = append(g.data, value...)
+			}
 		}
-		if reservedNames[ident.Name] || o.structTypes[ident.Name] || o.structFields[ident.Name] {
-			return true
+	}
+}
+
+const (
+	integrityBegin = "//goshield:integrity-begin"
+	integrityEnd   = "//goshield:integrity-end"
+)
+
+// integrityMarkers returns the -integrity begin and end comments of file in
+// source order.
+func integrityMarkers(file *ast.File) []*ast.Comment {
+	var markers []*ast.Comment
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if text := strings.TrimSpace(c.Text); text == integrityBegin || text == integrityEnd {
+				markers = append(markers, c)
+			}
 		}
-		if _, isTypeAlias := typeAliasMapping[ident.Name]; isTypeAlias {
-			return true
+	}
+	return markers
+}
+
+// addRegions records the string constants declared between the -integrity
+// markers of file. Regions don't nest and every begin needs its end.
+func (o *Obfuscator) addRegions(guard *tamperGuard, file *ast.File) error {
+	var begin *ast.Comment
+	for _, c := range o.markers[file] {
+		switch strings.TrimSpace(c.Text) {
+		case integrityBegin:
+			if begin != nil {
+				return o.errorf(c.Pos(), "-integrity: %s inside another region", integrityBegin)
+			}
+			begin = c
+		case integrityEnd:
+			if begin == nil {
+				return o.errorf(c.Pos(), "-integrity: %s without %s", integrityEnd, integrityBegin)
+			}
+			for _, decl := range file.Decls {
+				if decl.Pos() > begin.End() && decl.End() < c.Pos() {
+					guard.addConsts(decl)
+				}
+			}
+			begin = nil
 		}
-		if packageVars[ident.Name] {
-			ident.Name = getObfuscatedName(ident.Name)
-			return true
+	}
+	if begin != nil {
+		return o.errorf(begin.Pos(), "-integrity: %s without %s", integrityBegin, integrityEnd)
+	}
+	return nil
+}
+
+// collectTamperGuard records the constants to guard and resolves
+// -tamper-handler in the first file's package: -tamper-check takes the
+// string constants of the first file, -integrity those between markers in
+// any file of that package. It runs before the consts pass turns the
+// constants into vars. With every input copied through there is no file to
+// carry the guard, and none is added; finding nothing to guard is an error,
+// since the guard would only hash its own salt.
+func (o *Obfuscator) collectTamperGuard() error {
+	if len(o.files) == 0 {
+		return nil
+	}
+	guard := &tamperGuard{}
+	first := o.files[0]
+	if o.opts.TamperCheck {
+		for _, decl := range first.Decls {
+			guard.addConsts(decl)
 		}
-		if ident.Obj != nil && ident.Obj.Kind == ast.Var && ident.Name != "_" {
-			ident.Name = getObfuscatedName(ident.Name)
+		if len(guard.consts) == 0 {
+			return o.errorf(first.Name.Pos(), "-tamper-check: no package-level string constants in this file to guard")
 		}
-		return true
-	})
+	}
+	if o.opts.Integrity {
+		n := len(guard.consts)
+		for _, file := range o.files {
+			if file.Name.Name != first.Name.Name {
+				continue
+			}
+			if err := o.addRegions(guard, file); err != nil {
+				return err
+			}
+		}
+		if len(guard.consts) == n {
+			return o.errorf(first.Name.Pos(), "-integrity: no package-level string constants between %s and %s in package %s",
+				integrityBegin, integrityEnd, first.Name.Name)
+		}
+	}
+
+	if o.opts.TamperHandler != "" {
+		for _, file := range o.files {
+			if file.Name.Name != first.Name.Name {
+				continue
+			}
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if ok && fn.Recv == nil && fn.Name.Name == o.opts.TamperHandler &&
+					fn.Type.TypeParams == nil && fn.Type.Params.NumFields() == 0 {
+					guard.handler = fn.Name
+				}
+			}
+		}
+		if guard.handler == nil {
+			return o.errorf(first.Name.Pos(), "-tamper-handler: no func %s() in package %s", o.opts.TamperHandler, first.Name.Name)
+		}
+	}
+
+	o.tamper = guard
+	return nil
+}
+
+// injectTamperCheck appends an init function that hashes a random salt and
+// the guarded constants with SHA-256 and compares the sum with the one
+// computed now. On a mismatch it calls the handler, or exits with status 2.
+// The imports go on the package clause line so no line moves.
+func (e *textEncoder) injectTamperCheck(content string) string {
+	if !packageNameRe.MatchString(content) {
+		return content
+	}
+	salt := e.randomBytes(16)
+	sum := sha256.Sum256(append(append([]byte{}, salt...), e.tamper.data...))
+
+	sha := e.tamper.sha
+	imports := sha + ` "crypto/sha256"`
+	parts := make([]string, len(e.tamper.consts))
+	for i, ident := range e.tamper.consts {
+		parts[i] = "string(" + ident.Name + ")"
+	}
+	data := "append([]byte{" + byteList(salt) + "}, " + strings.Join(parts, "+") + "...)"
+	var handler string
+	if e.tamper.handler != nil {
+		handler = e.tamper.handler.Name + "()"
+	} else {
+		imports += "; " + e.tamper.os + ` "os"`
+		handler = e.tamper.os + ".Exit(2)"
+	}
+
+	content = importOnPackageLine(content, imports)
+	return content + "\nfunc init() {\n\tif " + sha + ".Sum256(" + data + ") != [32]byte{" + byteList(sum[:]) + "} {\n\t\t" +
+		handler + "\n\t}\n}\n"
+}
+
+// =============================================================================
+// EXPIRY GUARD
+// =============================================================================
+
+// parseExpire reads -expire: a date, which expires at the end of that day in
+// UTC, or an RFC 3339 time.
+func parseExpire(value string) (time.Time, error) {
+	if day, err := time.Parse("2006-01-02", value); err == nil {
+		return day.Add(24*time.Hour - time.Second), nil
+	}
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-expire %q: expected a date (2006-01-02) or an RFC 3339 time", value)
+	}
+	return deadline, nil
+}
+
+// expiryGuard is the -expire check: an init function and the imports it
+// needs under names of its own.
+type expiryGuard struct {
+	code    string
+	imports string
+}
+
+// newExpiryGuard builds the -expire check. It runs with the other passes,
+// which draw from rng one at a time, so the deadline gets a nested integer
+// expression; the message is left to the string pass of the file.
+func (o *Obfuscator) newExpiryGuard() *expiryGuard {
+	deadline, _ := parseExpire(o.opts.Expire)
+	timeName := o.reserveName()
+	osName := o.reserveName()
+	return &expiryGuard{
+		code: "\nfunc init() {\n\tif " + timeName + ".Now().Unix() > " + o.polyInteger(deadline.Unix(), 3) + " {\n" +
+			"\t\t" + osName + ".Stderr.WriteString(" + strconv.Quote(o.opts.ExpireMessage+"\n") + ")\n" +
+			"\t\t" + osName + ".Exit(1)\n\t}\n}\n",
+		imports: timeName + ` "time"; ` + osName + ` "os"`,
+	}
+}
+
+// =============================================================================
+// FUNCTION SELECTION
+// =============================================================================
+
+// selectedFuncNames returns the -only-funcs names together with the names
+// they were renamed to, or nil when every function is obfuscated.
+func (o *Obfuscator) selectedFuncNames() map[string]bool {
+	names := splitList(o.opts.OnlyFuncs)
+	if len(names) == 0 {
+		return nil
+	}
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[name] = true
+		if obfuscated, ok := o.nameMap[name]; ok {
+			selected[obfuscated] = true
+		}
+	}
+	return selected
 }
 
-func (o *Obfuscator) obfuscateFunctions() {
-	if *noFunctions {
+// inspectSelected walks the bodies of the -only-funcs functions, or every
+// file when no selection is set.
+func (o *Obfuscator) inspectSelected(f func(ast.Node) bool) {
+	selected := o.selectedFuncNames()
+	if selected == nil {
+		o.inspect(f)
 		return
 	}
+	for _, file := range o.files {
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil && selected[fn.Name.Name] {
+				ast.Inspect(fn.Body, f)
+			}
+		}
+	}
+}
 
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		fn, ok := n.(*ast.FuncDecl)
-		if !ok {
-			return true
+// lineFilter reports whether a 0-based line of the printed file may be
+// obfuscated by the text passes.
+type lineFilter func(line int) bool
+
+// selectedLines parses the printed file and admits only the lines spanned by
+// the -only-funcs functions. It returns nil when every line is admitted.
+func (e *textEncoder) selectedLines(content string) lineFilter {
+	selected := e.selected
+	if selected == nil {
+		return nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, 0)
+	if err != nil {
+		e.log.Error("Could not locate -only-funcs functions: %v", err)
+		return func(int) bool { return false }
+	}
+	lines := make(map[int]bool)
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !selected[fn.Name.Name] {
+			continue
 		}
-		name := fn.Name.Name
-		if o.declaredFuncs[name] || o.declaredMethods[name] {
-			fn.Name.Name = getObfuscatedName(name)
+		for line := fset.Position(fn.Pos()).Line; line <= fset.Position(fn.End()).Line; line++ {
+			lines[line-1] = true
 		}
-		return true
-	})
+	}
+	return func(line int) bool { return lines[line] }
+}
 
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		call, ok := n.(*ast.CallExpr)
-		if !ok {
-			return true
+// =============================================================================
+// TEXT-BASED OBFUSCATION
+// =============================================================================
+
+// render prints file and runs the text passes over the result. It only reads
+// the shared state, so files can be rendered concurrently.
+func (e *textEncoder) render(file *ast.File, fset *token.FileSet, header string) (string, error) {
+	text, err := printAST(file, fset)
+	if err != nil {
+		return "", fmt.Errorf("print failed: %v", err)
+	}
+	var comments *strings.Replacer
+	if e.opts.GarbleComments {
+		text, comments = hideComments(text, e.garbleComment)
+	} else if len(file.Comments) > 0 {
+		text, comments = hideComments(text, nil)
+	}
+	// The -expire check goes in before the string pass, which hides its
+	// message; its imports after, so their paths stay as they are
+	if e.expiry != nil {
+		text += e.expiry.code
+	}
+	text = e.obfuscateBacktickStrings(text, e.selectedLines(text), constLines(text))
+	var encoded strings.Builder
+	if err := e.obfuscateStringsInText(strings.NewReader(text), &encoded, e.selectedLines(text), constLines(text)); err != nil {
+		return "", err
+	}
+	text = encoded.String()
+	text = e.injectDecoder(text)
+	if e.watermark != "" {
+		text = e.injectWatermark(text)
+	}
+	if e.tamper != nil {
+		text = e.injectTamperCheck(text)
+	}
+	if e.expiry != nil {
+		text = importOnPackageLine(text, e.expiry.imports)
+	}
+	if comments != nil {
+		text = comments.Replace(text)
+	}
+	if e.opts.Minify {
+		text = minifyCode(text)
+	}
+	return header + text, nil
+}
+
+var (
+	quotedStringRe = regexp.MustCompile(`"([^"\\]|\\.)*"`)
+	typeAliasRe    = regexp.MustCompile(`^\s*[^\s]+\s+[^\s]+\s*=\s*"[^"]*"\s*$`)
+)
+
+// stringLiterals returns the start and end offsets of the raw and of the
+// interpreted string literals of content. Scanning tokens keeps quotes and
+// backticks inside other literals, runes and comments from being taken for
+// delimiters, which a regular expression over the text can't tell apart.
+func stringLiterals(content string) (raw, quoted [][]int) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(content))
+	var s scanner.Scanner
+	s.Init(file, []byte(content), nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return raw, quoted
 		}
-		if ident, ok := call.Fun.(*ast.Ident); ok {
-			if o.declaredFuncs[ident.Name] {
-				ident.Name = getObfuscatedName(ident.Name)
-			}
+		if tok != token.STRING {
+			continue
 		}
-		if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
-			if o.declaredMethods[sel.Sel.Name] {
-				sel.Sel.Name = getObfuscatedName(sel.Sel.Name)
+		start := file.Offset(pos)
+		// The scanner drops carriage returns from raw strings, so find the
+		// closing backtick in the text
+		if lit[0] == '`' {
+			end := strings.IndexByte(content[start+1:], '`')
+			if end < 0 {
+				return raw, quoted
 			}
+			raw = append(raw, []int{start, start + end + 2})
+			continue
 		}
-		return true
-	})
+		quoted = append(quoted, []int{start, start + len(lit)})
+	}
+}
 
-	ast.Inspect(o.file, func(n ast.Node) bool {
-		sel, ok := n.(*ast.SelectorExpr)
-		if !ok {
-			return true
-		}
-		if o.declaredMethods[sel.Sel.Name] && !o.structFields[sel.Sel.Name] {
-			sel.Sel.Name = getObfuscatedName(sel.Sel.Name)
+// constLines reports the lines of content that belong to const declarations.
+// Values there must stay untyped constants, so they are encoded with
+// constStringLiteral only.
+func constLines(content string) lineFilter {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, 0)
+	if err != nil {
+		return func(int) bool { return false }
+	}
+	lines := make(map[int]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if genDecl, ok := n.(*ast.GenDecl); ok && genDecl.Tok == token.CONST {
+			for line := fset.Position(genDecl.Pos()).Line; line <= fset.Position(genDecl.End()).Line; line++ {
+				lines[line-1] = true
+			}
 		}
 		return true
 	})
+	return func(line int) bool { return lines[line] }
 }
 
-// =============================================================================
-// TEXT-BASED OBFUSCATION
-// =============================================================================
+// encodeCodeChars splits embedded code into one expression per byte.
+func (e *textEncoder) encodeCodeChars(s string) string {
+	var parts []string
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch e.rng.Intn(3) {
+		case 0:
+			parts = append(parts, fmt.Sprintf("string(rune(%d))", c))
+		case 1:
+			parts = append(parts, fmt.Sprintf("string(rune(0x%x))", c))
+		default:
+			if c >= 32 && c < 127 && c != '"' && c != '\\' && c != '\'' {
+				parts = append(parts, fmt.Sprintf(`"%c"`, c))
+			} else {
+				parts = append(parts, fmt.Sprintf("string(rune(%d))", c))
+			}
+		}
+	}
+	return "(" + strings.Join(parts, "+") + ")"
+}
 
-func obfuscateBacktickStrings(content string) string {
-	if *noStrings {
+func (e *textEncoder) obfuscateBacktickStrings(content string, inScope, inConst lineFilter) string {
+	if e.opts.NoStrings || e.opts.NoBackticks {
 		return content
 	}
 
-	re := regexp.MustCompile("(?s)`[^`]+`")
+	var markers []string
+	for _, marker := range strings.Split(e.opts.CodeMarkers, ",") {
+		if marker != "" {
+			markers = append(markers, marker)
+		}
+	}
+
 	count := 0
 
-	result := re.ReplaceAllStringFunc(content, func(match string) string {
+	obfuscate := func(match string, constant bool) string {
 		innerContent := match[1 : len(match)-1]
 
-		if len(innerContent) < 20 {
+		if len(innerContent) < e.opts.MinBacktickLen {
 			return match
 		}
 
-		// Skip struct tags
-		if strings.Contains(innerContent, "json:") || strings.Contains(innerContent, "xml:") ||
-			strings.Contains(innerContent, "yaml:") || strings.Contains(innerContent, "gorm:") {
+		// Skip struct tags, whatever their keys
+		if structTagRe.MatchString(match) {
 			return match
 		}
 
-		// Check if it looks like code (JavaScript, SQL, etc.)
-		isCode := strings.Contains(innerContent, "function") ||
-			strings.Contains(innerContent, "await") ||
-			strings.Contains(innerContent, "async") ||
-			strings.Contains(innerContent, "const ") ||
-			strings.Contains(innerContent, "var ") ||
-			strings.Contains(innerContent, "let ") ||
-			strings.Contains(innerContent, "try {") ||
-			strings.Contains(innerContent, "catch") ||
-			strings.Contains(innerContent, "return ") ||
-			strings.Contains(innerContent, "SELECT ") ||
+		if e.keepStrings != nil && e.keepStrings.MatchString(innerContent) {
+			return match
+		}
+
+		// Template bodies mention keywords inside {{ }} actions, keep them whole
+		if e.opts.SkipTemplates && isTemplate(innerContent) {
+			return match
+		}
+
+		if constant {
+			count++
+			if e.opts.SplitTemplates && isTemplate(innerContent) {
+				return splitTemplate(innerContent, e.constStringLiteral)
+			}
+			return e.constStringLiteral(innerContent)
+		}
+
+		isSQL := strings.Contains(innerContent, "SELECT ") ||
 			strings.Contains(innerContent, "INSERT ") ||
 			strings.Contains(innerContent, "UPDATE ")
 
-		if !isCode {
-			return match
+		// SQL runs as-is, so hide it behind the runtime decoder instead of
+		// splitting it into characters
+		if isSQL || e.opts.Poly || e.opts.StringMode != "concat" {
+			count++
+			return e.encodeWithDecoder(innerContent)
 		}
 
-		var parts []string
-		for i := 0; i < len(innerContent); i++ {
-			c := innerContent[i]
-			switch rand.Intn(3) {
-			case 0:
-				parts = append(parts, fmt.Sprintf("string(%d)", c))
-			case 1:
-				parts = append(parts, fmt.Sprintf("string(0x%x)", c))
-			default:
-				if c >= 32 && c < 127 && c != '"' && c != '\\' && c != '\'' {
-					parts = append(parts, fmt.Sprintf(`"%c"`, c))
-				} else {
-					parts = append(parts, fmt.Sprintf("string(%d)", c))
-				}
+		// Check if it looks like code (JavaScript, etc.)
+		isCode := false
+		for _, marker := range markers {
+			if strings.Contains(innerContent, marker) {
+				isCode = true
+				break
 			}
 		}
 
+		if !isCode {
+			return match
+		}
+
 		count++
-		return "(" + strings.Join(parts, "+") + ")"
-	})
+		if e.opts.SplitTemplates && isTemplate(innerContent) {
+			return splitTemplate(innerContent, e.encodeCodeChars)
+		}
+		return e.encodeCodeChars(innerContent)
+	}
 
-	if count > 0 {
-		logInfo("Embedded code strings: %d", count)
+	var result strings.Builder
+	line, last := 0, 0
+	raw, _ := stringLiterals(content)
+	for _, loc := range raw {
+		line += strings.Count(content[last:loc[0]], "\n")
+		result.WriteString(content[last:loc[0]])
+		match := content[loc[0]:loc[1]]
+		if inScope == nil || inScope(line) {
+			encoded := obfuscate(match, inConst(line))
+			// Keep the line breaks of a multi-line string so the lines below
+			// don't move; a newline right after "(" ends no statement
+			if lost := strings.Count(match, "\n"); e.opts.GarbleComments && lost > 0 && encoded != match {
+				encoded = "(" + strings.Repeat("\n", lost) + encoded + ")"
+			}
+			result.WriteString(encoded)
+		} else {
+			result.WriteString(match)
+		}
+		line += strings.Count(match, "\n")
+		last = loc[1]
 	}
-	return result
+	result.WriteString(content[last:])
+
+	e.embeddedCode += count
+	return result.String()
 }
 
-func obfuscateStringsInText(content string) string {
-	if *noStrings {
-		return content
+// obfuscateStringsInText encodes the interpreted string literals of the text
+// read from r and writes the result to w a line at a time, so the pass holds
+// one line of the file rather than the file and its copies.
+func (e *textEncoder) obfuscateStringsInText(r io.Reader, w io.Writer, inScope, inConst lineFilter) error {
+	if e.opts.NoStrings {
+		_, err := io.Copy(w, r)
+		return err
 	}
 
-	lines := strings.Split(content, "\n")
 	inImportBlock := false
 	count := 0
 
-	for i, line := range lines {
+	// encodeLine returns line i with its strings, at the offsets of
+	// literals, encoded
+	encodeLine := func(i int, line string, literals [][]int) string {
 		trimmed := strings.TrimSpace(line)
+		if inScope != nil && !inScope(i) {
+			return line
+		}
 
 		if strings.HasPrefix(trimmed, "import (") {
 			inImportBlock = true
-			continue
+			return line
 		}
 		if inImportBlock && trimmed == ")" {
 			inImportBlock = false
-			continue
+			return line
 		}
 		if inImportBlock || strings.HasPrefix(trimmed, "import ") {
-			continue
+			return line
 		}
 
-		if strings.HasPrefix(trimmed, "const ") ||
-			strings.HasPrefix(trimmed, "case ") ||
-			strings.HasPrefix(trimmed, "Set(") ||
-			strings.HasPrefix(trimmed, ".Set(") ||
-			strings.Contains(line, ".Set(") ||
-			strings.Contains(line, "`json:") ||
-			strings.Contains(line, "`xml:") ||
-			strings.Contains(line, "`yaml:") ||
-			strings.Contains(line, "Flag") ||
-			strings.Contains(line, "flag.") ||
-			strings.Contains(line, "launcher.") {
-			continue
+		if len(literals) == 0 {
+			return line
 		}
 
-		typeAliasPattern := regexp.MustCompile(`^\s*[^\s]+\s+[^\s]+\s*=\s*"[^"]*"\s*$`)
-		if typeAliasPattern.MatchString(line) {
-			continue
+		// Look for flag and setter calls in the code only, so a composite
+		// literal element like "Flags" doesn't keep its whole line plain
+		code := quotedStringRe.ReplaceAllLiteralString(trimmed, `""`)
+		constant := inConst(i)
+		if strings.HasPrefix(code, "case ") ||
+			strings.HasPrefix(code, "Set(") ||
+			strings.Contains(code, ".Set(") ||
+			structTagRe.MatchString(line) ||
+			strings.Contains(code, "Flag") ||
+			strings.Contains(code, "flag.") ||
+			strings.Contains(code, "launcher.") {
+			return line
+		}
+
+		if typeAliasRe.MatchString(line) && !constant {
+			return line
 		}
 
 		isVarAssignment := strings.Contains(line, "=") &&
@@ -682,81 +4495,144 @@ func obfuscateStringsInText(content string) string {
 			!strings.Contains(line, "!=") &&
 			!strings.Contains(line, "(")
 
-		re := regexp.MustCompile(`"([^"\\]|\\.)*"`)
-
-		lines[i] = re.ReplaceAllStringFunc(line, func(match string) string {
+		encode := func(match string) string {
 			s, err := strconv.Unquote(match)
 			if err != nil {
 				return match
 			}
-			if len(s) < 3 {
+			if len(s) < e.opts.MinStringLen {
 				return match
 			}
 			if strings.Contains(s, "\\") {
 				return match
 			}
-			if strings.Contains(s, "://") && !isVarAssignment {
+			if strings.Contains(s, "://") && !isVarAssignment && !e.opts.ObfuscateURLs {
+				return match
+			}
+			if e.keepStrings != nil && e.keepStrings.MatchString(s) {
+				return match
+			}
+			if templatePlaceholderRe.FindString(s) == s {
+				return match
+			}
+			if e.opts.SkipTemplates && isTemplate(s) {
 				return match
 			}
 			count++
+			// Constant initializers can't call the decoder or convert
+			if constant {
+				if e.opts.SplitTemplates && isTemplate(s) {
+					return splitTemplate(s, e.constStringLiteral)
+				}
+				return e.constStringLiteral(s)
+			}
+			if e.opts.Poly {
+				return e.polyEncode(s)
+			}
+			if e.opts.StringMode != "concat" {
+				return e.encodeWithDecoder(s)
+			}
+			if e.opts.SplitTemplates && isTemplate(s) {
+				return splitTemplate(s, e.obfuscateFormatString)
+			}
 			if strings.Contains(s, "%") {
-				return obfuscateFormatString(s)
+				return e.obfuscateFormatString(s)
 			}
-			return obfuscateStringLiteral(s)
-		})
-	}
-
-	logInfo("String literals: %d", count)
-	return strings.Join(lines, "\n")
-}
-
-func obfuscateIntegersInText(content string) string {
-	if *noInts {
-		return content
+			return e.obfuscateStringLiteral(s)
+		}
+		var out strings.Builder
+		last := 0
+		for _, loc := range literals {
+			out.WriteString(line[last:loc[0]])
+			out.WriteString(encode(line[loc[0]:loc[1]]))
+			last = loc[1]
+		}
+		out.WriteString(line[last:])
+		return out.String()
 	}
 
-	lines := strings.Split(content, "\n")
-	count := 0
-
-	for i, line := range lines {
-		if strings.Contains(line, "string(") ||
-			strings.Contains(line, `"`) ||
-			strings.Contains(line, "`") ||
-			strings.Contains(line, "'") {
-			continue
+	in := bufio.NewReader(r)
+	out := bufio.NewWriter(w)
+	var literals literalScanner
+	for i := 0; ; i++ {
+		line, err := in.ReadString('\n')
+		if line != "" {
+			text := strings.TrimSuffix(line, "\n")
+			out.WriteString(encodeLine(i, text, literals.quoted(text)))
+			if len(text) < len(line) {
+				out.WriteByte('\n')
+			}
 		}
-
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "func ") ||
-			strings.Contains(line, "func (") ||
-			strings.HasPrefix(trimmed, "import") ||
-			strings.HasPrefix(trimmed, "package") ||
-			strings.HasPrefix(trimmed, "type ") ||
-			strings.HasPrefix(trimmed, "const ") ||
-			strings.HasPrefix(trimmed, "var ") {
-			continue
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
 		}
+	}
 
-		re := regexp.MustCompile(`([\s(=:,])(\d+)([\s),;\]])`)
+	e.strings += count
+	return out.Flush()
+}
 
-		lines[i] = re.ReplaceAllStringFunc(line, func(match string) string {
-			numRe := regexp.MustCompile(`\d+`)
-			numStr := numRe.FindString(match)
-			n, err := strconv.ParseInt(numStr, 10, 64)
-			if err != nil || n <= 10 || n > 100000 {
-				return match
+// literalScanner finds the interpreted string literals of Go source given to
+// it a line at a time. Those never span lines, but raw strings and general
+// comments do, so it remembers whether one is still open.
+type literalScanner struct {
+	inRaw, inComment bool
+}
+
+// quoted returns the start and end offsets of the interpreted string literals
+// of line, the next line of the source.
+func (s *literalScanner) quoted(line string) [][]int {
+	var found [][]int
+	for i := 0; i < len(line); i++ {
+		switch {
+		case s.inRaw:
+			end := strings.IndexByte(line[i:], '`')
+			if end < 0 {
+				return found
 			}
-			count++
-			prefix := match[0:1]
-			suffix := match[len(match)-1:]
-			return prefix + obfuscateInteger(n) + suffix
-		})
+			i += end
+			s.inRaw = false
+		case s.inComment:
+			end := strings.Index(line[i:], "*/")
+			if end < 0 {
+				return found
+			}
+			i += end + 1
+			s.inComment = false
+		case strings.HasPrefix(line[i:], "//"):
+			return found
+		case strings.HasPrefix(line[i:], "/*"):
+			s.inComment = true
+			i++
+		case line[i] == '`':
+			s.inRaw = true
+		case line[i] == '"' || line[i] == '\'':
+			// A rune holding a quote is skipped like a string
+			end := closingQuote(line, i)
+			if line[i] == '"' {
+				found = append(found, []int{i, end})
+			}
+			i = end - 1
+		}
 	}
+	return found
+}
 
-	if count > 0 {
-		logInfo("Integer literals: %d", count)
+// closingQuote returns the offset just past the string or rune literal that
+// opens at line[start], or the end of line if it isn't closed.
+func closingQuote(line string, start int) int {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case line[start]:
+			return i + 1
+		}
 	}
-	return strings.Join(lines, "\n")
+	return len(line)
 }
 
 // =============================================================================
@@ -811,6 +4687,12 @@ func minifyCode(content string) string {
 				canMerge = true
 			}
 
+			// A line comment runs to the end of the line, and directives
+			// such as //go:embed must start one
+			if strings.HasPrefix(line, "//") || strings.HasPrefix(nextLine, "//") {
+				canMerge = false
+			}
+
 			// Before case/default in switch, we need newline (Go inserts semicolon)
 			if strings.HasPrefix(nextLine, "case ") ||
 				strings.HasPrefix(nextLine, "case\"") ||
@@ -830,98 +4712,1050 @@ func minifyCode(content string) string {
 }
 
 // =============================================================================
-// MAIN
+// SPLIT
 // =============================================================================
 
-func printBanner() {
-	fmt.Println(`
-   ██████╗  ██████╗ ███████╗██╗  ██╗██╗███████╗██╗     ██████╗
-  ██╔════╝ ██╔═══██╗██╔════╝██║  ██║██║██╔════╝██║     ██╔══██╗
-  ██║  ███╗██║   ██║███████╗███████║██║█████╗  ██║     ██║  ██║
-  ██║   ██║██║   ██║╚════██║██╔══██║██║██╔══╝  ██║     ██║  ██║
-  ╚██████╔╝╚██████╔╝███████║██║  ██║██║███████╗███████╗██████╔╝
-   ╚═════╝  ╚═════╝ ╚══════╝╚═╝  ╚═╝╚═╝╚══════╝╚══════╝╚═════╝
-                    Go Source Code Obfuscator v1.0
-`)
+// Values of GOOS and GOARCH a file name may end with to restrict its builds
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+	"hurd": true, "illumos": true, "ios": true, "js": true, "linux": true, "nacl": true,
+	"netbsd": true, "openbsd": true, "plan9": true, "solaris": true, "wasip1": true,
+	"windows": true, "zos": true,
+}
+
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true,
+	"arm64be": true, "loong64": true, "mips": true, "mipsle": true, "mips64": true,
+	"mips64le": true, "mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true,
+	"ppc64le": true, "riscv": true, "riscv64": true, "s390": true, "s390x": true,
+	"sparc": true, "sparc64": true, "wasm": true,
+}
+
+// splitPaths names the -split parts of path: path itself, then name_1.go,
+// name_2.go, ... zero-padded, so the parts sort in order and package
+// initialization keeps the order of the file.
+func splitPaths(path string, n int) []string {
+	dir, base := filepath.Split(path)
+	stem := strings.TrimSuffix(base, ".go")
+	width := len(strconv.Itoa(n - 1))
+	paths := []string{path}
+	for k := 1; k < n; k++ {
+		paths = append(paths, filepath.Join(dir, fmt.Sprintf("%s_%0*d.go", stem, width, k)))
+	}
+	return paths
+}
+
+// checkSplitOrder rejects outputs that would sort between the parts of a
+// split file: their initializers would run in the middle of it.
+func checkSplitOrder(parts [][]string, copiesOut []string) error {
+	all := append([]string(nil), copiesOut...)
+	for _, paths := range parts {
+		all = append(all, paths...)
+	}
+	for i, paths := range parts {
+		if len(paths) < 2 {
+			continue
+		}
+		first, last := paths[0], paths[len(paths)-1]
+		for _, path := range all {
+			if filepath.Dir(path) != filepath.Dir(first) || path == first {
+				continue
+			}
+			own := false
+			for _, part := range parts[i] {
+				own = own || part == path
+			}
+			base := filepath.Base(path)
+			if !own && base > filepath.Base(first) && base <= filepath.Base(last) {
+				return fmt.Errorf("-split: %s sorts between the parts of %s and would change the initialization order", base, filepath.Base(first))
+			}
+		}
+	}
+	return nil
 }
 
-func main() {
-	flag.Parse()
+// fileConstraint returns the build constraint the name of a Go file implies
+// (file_linux.go, file_windows_amd64.go), or "".
+func fileConstraint(name string) string {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".go"), "_test")
+	elems := strings.Split(name, "_")
+	n := len(elems)
+	switch {
+	case n >= 3 && knownOS[elems[n-2]] && knownArch[elems[n-1]]:
+		return elems[n-2] + " && " + elems[n-1]
+	case n >= 2 && (knownOS[elems[n-1]] || knownArch[elems[n-1]]):
+		return elems[n-1]
+	}
+	return ""
+}
 
-	printBanner()
+// splitFile spreads the top-level declarations of a rendered file over
+// len(paths) parts of similar size, in order. Every part repeats the text
+// before the package clause and imports only the packages its declarations
+// use; blank imports go to every part. A constraint implied by the file name
+// becomes a //go:build line in the parts, whose names don't carry it.
+func splitFile(content string, paths []string) ([]string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, paths[0], content, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("-split: %v", err)
+	}
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
 
-	if *inputFile == "" || *outputFile == "" {
-		fmt.Println("Usage: goshield -i <input.go> -o <output.go> [options]")
-		fmt.Println("\nOptions:")
-		flag.PrintDefaults()
-		os.Exit(1)
+	header := content[:offset(file.Package)]
+	partHeader := header
+	if implied := fileConstraint(filepath.Base(paths[0])); implied != "" {
+		partHeader, err = addConstraint(header, implied)
+		if err != nil {
+			return nil, fmt.Errorf("-split: %v", err)
+		}
 	}
 
-	if *seed != "" {
-		rand.Seed(int64(hashString(*seed)))
-		logInfo("Using seed: %s", *seed)
-	} else {
-		rand.Seed(time.Now().UnixNano())
+	// Import names, with the text of their specs
+	type importSpec struct {
+		name, text string
+	}
+	var imports []importSpec
+	bodyStart := offset(file.Name.End())
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			bodyStart = offset(gen.End())
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.ImportSpec)
+				path, _ := strconv.Unquote(spec.Path.Value)
+				name := guessPackageName(path)
+				if spec.Name != nil {
+					name = spec.Name.Name
+				}
+				if name == "." {
+					return nil, fmt.Errorf("-split: can't tell which declarations use the dot import of %s", path)
+				}
+				imports = append(imports, importSpec{name, content[offset(spec.Pos()):offset(spec.End())]})
+			}
+			continue
+		}
+		decls = append(decls, decl)
+	}
+
+	// Each declaration takes the comments before it; whatever follows the
+	// last one goes with it
+	chunks := make([]string, len(decls))
+	uses := make([]map[string]bool, len(decls))
+	total := 0
+	prev := bodyStart
+	for i, decl := range decls {
+		end := offset(decl.End())
+		if i == len(decls)-1 {
+			end = len(content)
+		}
+		chunks[i] = strings.Trim(content[prev:end], "; \t\n")
+		prev = end
+		total += len(chunks[i])
+		uses[i] = make(map[string]bool)
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Obj == nil {
+					uses[i][pkg.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	n := len(paths)
+	partChunks := make([][]string, n)
+	partUses := make([]map[string]bool, n)
+	for k := range partUses {
+		partUses[k] = make(map[string]bool)
+	}
+	// A declaration goes to the part its middle byte falls in
+	size := 0
+	for i, chunk := range chunks {
+		part := 0
+		if total > 0 {
+			part = (size + len(chunk)/2) * n / total
+		}
+		partChunks[part] = append(partChunks[part], chunk)
+		for name := range uses[i] {
+			partUses[part][name] = true
+		}
+		size += len(chunk)
+	}
+
+	for _, spec := range imports {
+		used := spec.name == "_"
+		for _, names := range partUses {
+			used = used || names[spec.name]
+		}
+		if !used {
+			return nil, fmt.Errorf("-split: can't tell which declarations use %s; name the import", spec.text)
+		}
 	}
 
-	fmt.Printf("\n  Input:  %s\n", *inputFile)
-	fmt.Printf("  Output: %s\n\n", *outputFile)
+	parts := make([]string, n)
+	for k := range parts {
+		var b strings.Builder
+		if k == 0 {
+			b.WriteString(header)
+		} else {
+			b.WriteString(partHeader)
+		}
+		b.WriteString("package " + file.Name.Name + "\n")
+		var specs []string
+		for _, spec := range imports {
+			if spec.name == "_" || partUses[k][spec.name] {
+				specs = append(specs, "\t"+spec.text+"\n")
+			}
+		}
+		if len(specs) > 0 {
+			b.WriteString("\nimport (\n" + strings.Join(specs, "") + ")\n")
+		}
+		for _, chunk := range partChunks[k] {
+			b.WriteString("\n" + chunk + "\n")
+		}
+		parts[k] = b.String()
+	}
+	return parts, nil
+}
 
-	// Parse
-	file, fset, err := parseFile(*inputFile)
+// addConstraint ANDs expr into the build constraint of a file header,
+// replacing its //go:build and // +build lines with one //go:build line.
+func addConstraint(header, expr string) (string, error) {
+	combined, err := constraint.Parse("//go:build " + expr)
 	if err != nil {
-		logError("Parse failed: %v", err)
-		os.Exit(1)
+		return "", err
+	}
+	var goBuild constraint.Expr
+	var plusBuild []constraint.Expr
+	var kept []string
+	for _, line := range strings.Split(header, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !constraint.IsGoBuild(trimmed) && !constraint.IsPlusBuild(trimmed) {
+			kept = append(kept, line)
+			continue
+		}
+		x, err := constraint.Parse(trimmed)
+		if err != nil {
+			return "", err
+		}
+		if constraint.IsGoBuild(trimmed) {
+			goBuild = x
+		} else {
+			plusBuild = append(plusBuild, x)
+		}
+	}
+	// //go:build wins over // +build lines, as with the go command
+	if goBuild != nil {
+		if goBuild.String() != combined.String() {
+			combined = &constraint.AndExpr{X: goBuild, Y: combined}
+		}
+	} else {
+		for _, x := range plusBuild {
+			combined = &constraint.AndExpr{X: x, Y: combined}
+		}
+	}
+	rest := strings.TrimLeft(strings.Join(kept, "\n"), "\n")
+	return "//go:build " + combined.String() + "\n\n" + rest, nil
+}
+
+var majorVersionRe = regexp.MustCompile(`^v[0-9]+$`)
+
+// guessPackageName returns the name an import path is usually imported
+// under: its last element, skipping a major version (example.com/mod/v2)
+// and dropping a gopkg.in version (yaml.v3) or a go- prefix.
+func guessPackageName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && majorVersionRe.MatchString(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	return strings.TrimPrefix(name, "go-")
+}
+
+// =============================================================================
+// SCORE
+// =============================================================================
+
+// Score rates a run from 0 to 100 for -score. Each category is a percentage
+// and Total weighs them: identifiers 35, strings 25, name entropy 20,
+// integers 10 and control flow 10.
+type Score struct {
+	Total int `json:"total"`
+	// Identifiers, Strings and Integers are the shares of the input's names
+	// and literals the run transformed
+	Identifiers int `json:"identifiers"`
+	Strings     int `json:"strings"`
+	Integers    int `json:"integers"`
+	// NameEntropy compares the character entropy of the final names with
+	// the most the lookalike characters can give
+	NameEntropy int `json:"name_entropy"`
+	// ControlFlow is the share of switch statements rewritten as if/else
+	// chains by -switch-to-if
+	ControlFlow int `json:"control_flow"`
+}
+
+// countCandidates records the declared names, the string and integer
+// literals and the switch statements -score measures the run against. Import
+// paths and struct tags can't be encoded and are left out, as are main, init
+// and blank names.
+func (o *Obfuscator) countCandidates() {
+	o.declNames = make(map[string]bool)
+	declare := func(ident *ast.Ident) {
+		if ident.Name != "_" && ident.Name != "main" && ident.Name != "init" {
+			o.declNames[ident.Name] = true
+		}
+	}
+	tags := make(map[*ast.BasicLit]bool)
+	o.inspect(func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.FuncDecl:
+			declare(x.Name)
+		case *ast.SwitchStmt:
+			o.switches++
+		case *ast.Ident:
+			if x.Obj != nil && x.Obj.Pos() == x.Pos() {
+				declare(x)
+			}
+		case *ast.StructType:
+			for _, field := range x.Fields.List {
+				for _, name := range field.Names {
+					declare(name)
+				}
+			}
+		case *ast.Field:
+			if x.Tag != nil {
+				tags[x.Tag] = true
+			}
+		case *ast.BasicLit:
+			if x.Kind == token.STRING && !tags[x] {
+				o.stringLits++
+			} else if x.Kind == token.INT {
+				o.intLits++
+			}
+		}
+		return true
+	})
+}
+
+// score rates the run from stats, the name map and the counted candidates.
+func (o *Obfuscator) score() Score {
+	var sc Score
+	renamed := 0
+	for name := range o.declNames {
+		if obfuscated, ok := o.nameMap[name]; ok && obfuscated != name {
+			renamed++
+		}
+	}
+	sc.Identifiers = percent(renamed, len(o.declNames))
+	sc.Strings = percent(o.stats.Strings+o.stats.EmbeddedCode, o.stringLits)
+	sc.Integers = percent(o.stats.Integers, o.intLits)
+	sc.ControlFlow = percent(o.stats.Switches, o.switches)
+
+	// Average the entropy of each name's characters, weighted by length
+	var bits float64
+	chars := 0
+	for name := range o.declNames {
+		if obfuscated, ok := o.nameMap[name]; ok {
+			name = obfuscated
+		}
+		runes := []rune(name)
+		counts := make(map[rune]int)
+		for _, r := range runes {
+			counts[r]++
+		}
+		for _, c := range counts {
+			p := float64(c) / float64(len(runes))
+			bits -= float64(c) * math.Log2(p)
+		}
+		chars += len(runes)
+	}
+	if chars > 0 {
+		sc.NameEntropy = int(math.Min(100, 100*bits/float64(chars)/math.Log2(float64(len(obfuscationChars)))))
+	}
+
+	sc.Total = (35*sc.Identifiers + 25*sc.Strings + 20*sc.NameEntropy + 10*sc.Integers + 10*sc.ControlFlow) / 100
+	return sc
+}
+
+// percent returns part out of whole as 0 to 100, 0 when there is nothing to
+// count. Passes may touch literals the input count missed, so it is capped.
+func percent(part, whole int) int {
+	if whole == 0 {
+		return 0
+	}
+	if part >= whole {
+		return 100
+	}
+	return 100 * part / whole
+}
+
+// =============================================================================
+// MERGED OUTPUT
+// =============================================================================
+
+// mergeFiles joins the Go files at paths into the source of one file: the
+// header and package clause of the first, the imports of all of them in one
+// declaration without duplicates, then the rest of each file in order. Names
+// two files declare at the top level, an import name standing for two paths
+// or clashing with a declaration, other packages or build constraints, and
+// generated or cgo files are errors, since the single file couldn't keep them.
+func (o *Obfuscator) mergeFiles(paths []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	var header, pkg, constraints string
+	declared := make(map[string]token.Position)
+	imported := make(map[string]string)
+	importPos := make(map[string]token.Position)
+	seen := make(map[string]bool)
+	var specs, bodies []string
+	for i, path := range paths {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read failed: %v", err)
+		}
+		if err := o.checkFileSize(path, src); err != nil {
+			return nil, err
+		}
+		file, err := o.parseFile(fset, path, src)
+		if err != nil {
+			return nil, fmt.Errorf("parse failed:\n%v", err)
+		}
+		if isGeneratedFile(src) || isCgoFile(file) {
+			return nil, fmt.Errorf("%s is generated or uses cgo and can't be merged, obfuscate it with -dir instead", path)
+		}
+		tokFile := fset.File(file.Pos())
+		fileConstraints := strings.Join(buildConstraints(src), "\n")
+		if i == 0 {
+			pkg, constraints = file.Name.Name, fileConstraints
+			header = string(src[:tokFile.Offset(file.Package)])
+		} else if file.Name.Name != pkg {
+			return nil, fmt.Errorf("%s is package %s, %s package %s", path, file.Name.Name, paths[0], pkg)
+		} else if fileConstraints != constraints {
+			return nil, fmt.Errorf("%s and %s have different build constraints", paths[0], path)
+		}
+
+		declare := func(name string, pos token.Pos) error {
+			if name == "_" {
+				return nil
+			}
+			if first, ok := declared[name]; ok {
+				return fmt.Errorf("%s: %s redeclared, first declared at %s", fset.Position(pos), name, first)
+			}
+			declared[name] = fset.Position(pos)
+			return nil
+		}
+		bodyStart := file.Name.End()
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok == token.IMPORT {
+					for _, spec := range d.Specs {
+						imp := spec.(*ast.ImportSpec)
+						name := importName(imp)
+						if other, ok := imported[name]; ok && other != imp.Path.Value && name != "_" && name != "." {
+							return nil, fmt.Errorf("%s: %s names %s here but %s in %s",
+								fset.Position(imp.Pos()), name, imp.Path.Value, other, importPos[name].Filename)
+						}
+						text := string(src[tokFile.Offset(imp.Pos()):tokFile.Offset(imp.End())])
+						if !seen[text] {
+							seen[text] = true
+							specs = append(specs, text)
+							imported[name] = imp.Path.Value
+							importPos[name] = fset.Position(imp.Pos())
+						}
+					}
+					bodyStart = d.End()
+					continue
+				}
+				for _, spec := range d.Specs {
+					switch sp := spec.(type) {
+					case *ast.TypeSpec:
+						err = declare(sp.Name.Name, sp.Name.Pos())
+					case *ast.ValueSpec:
+						for _, name := range sp.Names {
+							if err = declare(name.Name, name.Pos()); err != nil {
+								break
+							}
+						}
+					}
+					if err != nil {
+						return nil, err
+					}
+				}
+			case *ast.FuncDecl:
+				name := d.Name.Name
+				if d.Recv != nil {
+					name = receiverName(d.Recv) + "." + name
+				} else if name == "init" {
+					continue
+				}
+				if err := declare(name, d.Name.Pos()); err != nil {
+					return nil, err
+				}
+			}
+		}
+		bodies = append(bodies, strings.TrimLeft(string(src[tokFile.Offset(bodyStart):]), "\n"))
+	}
+	names := make([]string, 0, len(importPos))
+	for name := range importPos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if first, ok := declared[name]; ok && name != "_" && name != "." {
+			pos := importPos[name]
+			return nil, fmt.Errorf("%s: import %s clashes with %s declared at %s", pos, name, name, first)
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString(header)
+	out.WriteString("package " + pkg + "\n")
+	if len(specs) > 0 {
+		out.WriteString("\nimport (\n\t" + strings.Join(specs, "\n\t") + "\n)\n")
+	}
+	for _, body := range bodies {
+		out.WriteString("\n" + body)
+		if !strings.HasSuffix(body, "\n") {
+			out.WriteString("\n")
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+// receiverName returns the name of the type a method is declared on.
+func receiverName(recv *ast.FieldList) string {
+	expr := recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
 	}
+}
+
+// =============================================================================
+// LIBRARY API
+// =============================================================================
+
+// Stats counts what an obfuscation run changed, or would change with DryRun.
+type Stats struct {
+	Files   int `json:"files"`
+	Renamed int `json:"renamed"`
+	// ByKind splits Renamed into func, method, type, field, import and var
+	// (variables, constants, parameters, labels and anything else). A name
+	// declared as several kinds counts under each, so the sum may be larger.
+	ByKind       map[string]int `json:"by_kind"`
+	Strings      int            `json:"strings"`
+	EmbeddedCode int            `json:"embedded_code"`
+	Integers     int            `json:"integers"`
+	Switches     int            `json:"switches"`
+	Reserved     []string       `json:"reserved"`
+	Score        *Score         `json:"score,omitempty"`
+}
+
+// ProgressFunc is called when a stage starts (done counts the stages already
+// finished) and again when it ends.
+type ProgressFunc func(stage string, done, total int)
+
+func (o Options) progress(stage string, done, total int) {
+	if o.Progress != nil {
+		o.Progress(stage, done, total)
+	}
+}
+
+// Pass is a custom step of an obfuscation run over the syntax trees of the
+// files being obfuscated (generated and cgo files copied through are not
+// among them), which it may change in place. Passes set in Options.Passes
+// run at one fixed point: after every built-in renaming and integer pass,
+// so they see every name already renamed, and before strings are encoded.
+// The built-in passes are not Pass values and can't be reordered. What a
+// pass returns is reported like a built-in pass error, under its name, with
+// nothing written.
+type Pass interface {
+	Name() string
+	Apply(files []*ast.File, fset *token.FileSet) error
+}
 
-	// Collect
-	obf := NewObfuscator(file, fset)
-	obf.collectTypeNames()
-	obf.collectDeclaredFunctions()
-	obf.collectStructFields()
-	obf.collectStructTypes()
+// stage is one named step of an obfuscation run. Errors of ordinary stages
+// are collected so one run reports every problem; a fatal stage stops the run
+// at once, and stages that write output are skipped after any error.
+type stage struct {
+	name   string
+	run    func() error
+	fatal  bool
+	writes bool
+}
 
-	fmt.Println("  Processing...")
+// Validate rejects option combinations that can't produce a working run.
+func (o Options) Validate() error {
+	if o.MinStringLen < 0 || o.MinBacktickLen < 0 {
+		return fmt.Errorf("-min-string-len and -min-backtick-len must not be negative")
+	}
+	if o.KeepComments && o.Minify {
+		return fmt.Errorf("-keep-comments cannot be combined with -minify")
+	}
+	if o.GarbleComments && (o.KeepComments || o.Minify) {
+		return fmt.Errorf("-garble-comments cannot be combined with -keep-comments or -minify")
+	}
+	if o.TamperHandler != "" && !o.TamperCheck && !o.Integrity {
+		return fmt.Errorf("-tamper-handler needs -tamper-check or -integrity")
+	}
+	if o.KeepExportedFields && !o.Fields {
+		return fmt.Errorf("-keep-exported-fields needs -fields")
+	}
+	if o.Expire != "" {
+		if _, err := parseExpire(o.Expire); err != nil {
+			return err
+		}
+	}
+	if o.Jobs < 0 {
+		return fmt.Errorf("-j must not be negative")
+	}
+	if o.MaxFileSize < 0 {
+		return fmt.Errorf("-max-file-size must not be negative")
+	}
+	if o.OnlyExported && (o.KeepExported || o.OnlyUnexported) {
+		return fmt.Errorf("-only-exported cannot be combined with -keep-exported or -only-unexported")
+	}
+	if o.SkipTemplates && o.SplitTemplates {
+		return fmt.Errorf("-skip-templates cannot be combined with -split-templates")
+	}
+	// Shorter names can spell the keyword "type" and run out of unique values
+	if o.NameLen < 5 {
+		return fmt.Errorf("-name-len must be at least 5")
+	}
+	if o.IntMin > o.IntMax {
+		return fmt.Errorf("-int-min (%d) must not be greater than -int-max (%d)", o.IntMin, o.IntMax)
+	}
+	switch o.StringMode {
+	case "concat", "xor", "base64", "table":
+	default:
+		return fmt.Errorf("unknown -string-mode %q (expected concat, xor, base64 or table)", o.StringMode)
+	}
+	if _, err := regexp.Compile(o.KeepStrings); err != nil {
+		return fmt.Errorf("-keep-strings: %v", err)
+	}
+	if _, err := regexp.Compile(o.FuncPattern); err != nil {
+		return fmt.Errorf("-func-pattern: %v", err)
+	}
+	if _, err := regexp.Compile(o.TypePattern); err != nil {
+		return fmt.Errorf("-type-pattern: %v", err)
+	}
+	if o.Split < 0 {
+		return fmt.Errorf("-split must not be negative")
+	}
+	if o.Split > 1 && o.Output == "-" {
+		return fmt.Errorf("-split writes several files; use an output file or directory instead of -o -")
+	}
+	return nil
+}
 
-	// AST obfuscation
-	obf.obfuscateConsts()
-	obf.obfuscateImports()
-	obf.updateImportReferences()
-	obf.obfuscateStructTypes()
-	obf.obfuscateVariables()
-	obf.obfuscateFunctions()
+// Obfuscate obfuscates the inputs with one shared rename map and writes each
+// result to the output path at the same index, or to stdout for "-"; several
+// inputs with a single output are merged into that one file (see mergeFiles).
+// With DryRun nothing is written. Outputs are written only once every file
+// succeeded, so a failed run leaves none behind. It stops with ctx.Err() once
+// ctx is cancelled, checking between stages and between files.
+func Obfuscate(ctx context.Context, inputs, outputs []string, options Options) (*Stats, error) {
+	merge := len(inputs) > 1 && len(outputs) == 1
+	if len(inputs) != len(outputs) && !merge {
+		return nil, fmt.Errorf("%d inputs but %d outputs", len(inputs), len(outputs))
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	o := newObfuscator(options)
+	o.stats = Stats{Files: len(inputs)}
 
-	// Write intermediate
-	if err := writeAST(*outputFile, file, fset); err != nil {
-		logError("Write failed: %v", err)
-		os.Exit(1)
+	if o.opts.MapIn != "" {
+		if err := o.loadNameMap(o.opts.MapIn); err != nil {
+			return nil, err
+		}
 	}
 
-	// Text obfuscation
-	content, err := ioutil.ReadFile(*outputFile)
+	seedValue, err := resolveSeed(o.opts)
 	if err != nil {
-		logError("Read failed: %v", err)
-		os.Exit(1)
+		return nil, err
+	}
+	resolvedSeed := int64(hashString(seedValue))
+	if o.opts.Salt != "" {
+		resolvedSeed = saltSeed(resolvedSeed, o.opts.Salt, inputs)
 	}
+	o.rng = rand.New(rand.NewSource(resolvedSeed))
+	o.log.Info("Using seed: %s (resolved %d)", seedValue, resolvedSeed)
 
-	text := string(content)
-	text = obfuscateBacktickStrings(text)
-	text = obfuscateStringsInText(text)
-	text = obfuscateIntegersInText(text)
+	fset := o.fset
+	var files []*ast.File
+	var filesOut []string
+	var headers []string
+	// Generated and cgo files, copied through with the other outputs
+	var copies, copiesOut []string
+	var copied []*ast.File
 
-	// Minify if requested
-	if *minify {
-		text = minifyCode(text)
-		logInfo("Code minified (single line)")
+	stages := []stage{
+		{name: "parse", fatal: true, run: func() error {
+			// Merged inputs are parsed as one file named after the output
+			var merged []byte
+			if merge {
+				var err error
+				if merged, err = o.mergeFiles(inputs); err != nil {
+					return err
+				}
+				inputs = outputs
+			}
+			for i, path := range inputs {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				src := merged
+				if src == nil {
+					var err error
+					if src, err = ioutil.ReadFile(path); err != nil {
+						return fmt.Errorf("read failed: %v", err)
+					}
+					// Files copied through are held to no limit
+					if !o.copiedThrough(path, src) {
+						if err := o.checkFileSize(path, src); err != nil {
+							return err
+						}
+					}
+				}
+				file, err := o.parseFile(fset, path, src)
+				if err != nil {
+					return fmt.Errorf("parse failed:\n%v", err)
+				}
+				// The output of an earlier run is copied through, not obfuscated twice
+				if !o.opts.Force && isObfuscatedFile(src) {
+					if err := o.keepGeneratedNames(file); err != nil {
+						return err
+					}
+					copied = append(copied, file)
+					copies = append(copies, string(src))
+					copiesOut = append(copiesOut, outputs[i])
+					o.log.Error("%s is already obfuscated, copying it unchanged (pass -force to obfuscate it again)", filepath.Base(path))
+					continue
+				}
+				// Generated files are copied through untouched
+				if !o.opts.ObfuscateGenerated && !o.opts.Force && isGeneratedFile(src) {
+					if err := o.keepGeneratedNames(file); err != nil {
+						return err
+					}
+					copied = append(copied, file)
+					copies = append(copies, string(src))
+					copiesOut = append(copiesOut, outputs[i])
+					o.log.Info("Skipped generated file: %s", filepath.Base(path))
+					continue
+				}
+				// The cgo preamble is C code kept in a comment and C.* names
+				// belong to it, so cgo files are copied through as well
+				if isCgoFile(file) {
+					if err := o.keepGeneratedNames(file); err != nil {
+						return err
+					}
+					o.log.Error("%s imports \"C\", copying it unchanged", filepath.Base(path))
+					copied = append(copied, file)
+					copies = append(copies, string(src))
+					copiesOut = append(copiesOut, outputs[i])
+					continue
+				}
+				if err := o.keepLinknames(file); err != nil {
+					return err
+				}
+				if isProtocFile(src) {
+					if err := o.keepProtocNames(file); err != nil {
+						return err
+					}
+				}
+				if !o.opts.NoReflectNames {
+					if err := o.keepReflectNames(file); err != nil {
+						return err
+					}
+				}
+				files = append(files, file)
+				filesOut = append(filesOut, outputs[i])
+				headers = append(headers, o.fileHeader(src))
+			}
+			o.files = files
+			o.copied = copied
+			return nil
+		}},
+		{name: "typecheck", fatal: true, run: func() error {
+			if o.opts.NoTypeCheck {
+				return nil
+			}
+			err := o.typeCheck()
+			if err != nil && o.opts.SkipTypeCheck {
+				o.log.Info("Input does not type-check, continuing (-skip-typecheck)")
+				o.log.Debug("%v", err)
+				return nil
+			}
+			return err
+		}},
+		{name: "collect", run: func() error {
+			o.warnLibraryPackages()
+			o.collectTypeNames()
+			if !o.opts.NoTypeCheck {
+				o.collectInterfaceMethods()
+			}
+			if err := o.keepProtobufTypes(); err != nil {
+				return err
+			}
+			if err := o.collectDeclaredFunctions(); err != nil {
+				return err
+			}
+			o.collectGlobals()
+			if err := o.collectStructFields(); err != nil {
+				return err
+			}
+			o.collectStructTypes()
+			if o.opts.Score {
+				o.countCandidates()
+			}
+			if o.opts.TamperCheck || o.opts.Integrity {
+				return o.collectTamperGuard()
+			}
+			return nil
+		}},
+		{name: "consts", run: func() error { return o.obfuscateConsts() }},
+		{name: "package", run: func() error { return o.obfuscatePackageName() }},
+		{name: "imports", run: func() error {
+			if err := o.obfuscateImports(); err != nil {
+				return err
+			}
+			return o.updateImportReferences()
+		}},
+		{name: "fields", run: func() error { return o.obfuscateFields() }},
+		{name: "types", run: func() error { return o.obfuscateStructTypes() }},
+		{name: "vars", run: func() error { return o.obfuscateVariables() }},
+		{name: "functions", run: func() error { return o.obfuscateFunctions() }},
+		{name: "labels", run: func() error { return o.obfuscateLabels() }},
+		{name: "switches", run: func() error { return o.lowerSwitches() }},
+		{name: "ints", run: func() error { return o.obfuscateIntegers() }},
+		{name: "external", run: func() error { return o.renameExternalRefs() }},
+		{name: "strings", writes: true, run: func() error {
+			// Each file draws its random source in file order, so the
+			// result doesn't depend on how files are spread over workers
+			encoders := make([]*textEncoder, len(files))
+			selected := o.selectedFuncNames()
+			for i := range files {
+				encoders[i] = &textEncoder{
+					opts:        &o.opts,
+					log:         o.log,
+					keepStrings: o.keepStrings,
+					selected:    selected,
+					rng:         rand.New(rand.NewSource(o.rng.Int63())),
+				}
+			}
+			// One copy of the watermark is enough, the first file carries it
+			if o.opts.Watermark != "" && len(encoders) > 0 {
+				encoders[0].watermark = o.reserveName()
+			}
+			if o.tamper != nil {
+				o.tamper.sha = o.reserveName()
+				if o.tamper.handler == nil {
+					o.tamper.os = o.reserveName()
+				}
+				encoders[0].tamper = o.tamper
+			}
+			// The -expire check goes in the first file built with the
+			// program, not a test
+			if o.opts.Expire != "" {
+				guard := o.newExpiryGuard()
+				for i := range files {
+					if !strings.HasSuffix(filesOut[i], "_test.go") {
+						encoders[i].expiry = guard
+						break
+					}
+				}
+			}
+			// With -split a file is written as several parts; test files
+			// stay whole, their names must end in _test.go
+			parts := make([][]string, len(files))
+			for i := range files {
+				parts[i] = []string{filesOut[i]}
+				if o.opts.Split > 1 && filesOut[i] != "-" && !strings.HasSuffix(filesOut[i], "_test.go") {
+					parts[i] = splitPaths(filesOut[i], o.opts.Split)
+				}
+			}
+			if err := checkSplitOrder(parts, copiesOut); err != nil {
+				return err
+			}
+			var partsOut []string
+			for _, paths := range parts {
+				partsOut = append(partsOut, paths...)
+			}
+			// Workers write each file to a temp file next to its output,
+			// renamed into place once every file rendered
+			errs := make([]error, len(files))
+			texts := make([]string, len(files))
+			jobs := o.opts.Jobs
+			if jobs == 0 {
+				jobs = runtime.GOMAXPROCS(0)
+			}
+			next := make(chan int)
+			var wg sync.WaitGroup
+			for w := 0; w < jobs && w < len(files); w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range next {
+						text, err := encoders[i].render(files[i], fset, headers[i])
+						if err == nil && !o.opts.DryRun {
+							if filesOut[i] == "-" {
+								texts[i] = markObfuscated(text)
+							} else {
+								err = writeParts(text, parts[i])
+							}
+						}
+						errs[i] = err
+					}
+				}()
+			}
+			for i := range files {
+				if ctx.Err() != nil {
+					break
+				}
+				next <- i
+			}
+			close(next)
+			wg.Wait()
+			if err := ctx.Err(); err != nil {
+				removeTempOutputs(partsOut)
+				return err
+			}
+			if err := errors.Join(errs...); err != nil {
+				removeTempOutputs(partsOut)
+				return err
+			}
+			if !o.opts.DryRun {
+				var partTexts []string
+				for i, paths := range parts {
+					for range paths {
+						partTexts = append(partTexts, texts[i])
+					}
+				}
+				if err := commitOutputs(partsOut, partTexts, copies, copiesOut); err != nil {
+					return err
+				}
+			}
+
+			for i, e := range encoders {
+				if len(files) > 1 {
+					o.log.Info("File: %s", filepath.Base(filesOut[i]))
+				}
+				if e.embeddedCode > 0 {
+					o.log.Info("Embedded code strings: %d", e.embeddedCode)
+				}
+				o.log.Info("String literals: %d", e.strings)
+				if o.opts.Minify {
+					o.log.Info("Code minified (single line)")
+				}
+				o.stats.Strings += e.strings
+				o.stats.EmbeddedCode += e.embeddedCode
+			}
+			return nil
+		}},
+	}
+
+	// Custom passes go in before the strings stage, the last one
+	custom := make([]stage, len(options.Passes))
+	for i, pass := range options.Passes {
+		pass := pass
+		custom[i] = stage{name: pass.Name(), run: func() error { return pass.Apply(files, fset) }}
+	}
+	stages = append(stages[:len(stages)-1:len(stages)-1], append(custom, stages[len(stages)-1])...)
+
+	var errs []error
+	for i, st := range stages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if st.writes && len(errs) > 0 {
+			break
+		}
+		options.progress(st.name, i, len(stages))
+		// When every input was copied through nothing is left to
+		// obfuscate, only the copies to write
+		if i > 0 && len(files) == 0 && !st.writes {
+			options.progress(st.name, i+1, len(stages))
+			continue
+		}
+		if err := st.run(); err != nil {
+			if st.fatal || ctx.Err() != nil {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("%s: %v", st.name, err))
+		}
+		options.progress(st.name, i+1, len(stages))
 	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	o.stats.ByKind = make(map[string]int)
+	kinds := o.renameKinds()
+	for original, obfuscated := range o.nameMap {
+		if original == obfuscated {
+			continue
+		}
+		o.stats.Renamed++
+		// names from -map-in or copied files have no declaration here
+		if len(kinds[original]) == 0 {
+			o.stats.ByKind["var"]++
+		}
+		for kind := range kinds[original] {
+			o.stats.ByKind[kind]++
+		}
+	}
+	o.stats.Reserved = o.reservedDecls()
+	if o.opts.Score {
+		score := o.score()
+		o.stats.Score = &score
+	}
+	result := o.stats
 
-	if err := ioutil.WriteFile(*outputFile, []byte(text), 0644); err != nil {
-		logError("Final write failed: %v", err)
-		os.Exit(1)
+	if o.opts.MapOut != "" && !o.opts.DryRun {
+		if err := o.saveNameMap(o.opts.MapOut); err != nil {
+			return nil, err
+		}
 	}
+	return &result, nil
+}
 
-	fmt.Println()
-	logSuccess("Obfuscation complete!")
-	logSuccess("Identifiers renamed: %d", len(nameMap))
-	fmt.Printf("\n  Output saved to: %s\n\n", *outputFile)
+// ObfuscateDir obfuscates every .go file of dir into outDir, keeping the
+// file names, with one shared rename map.
+func ObfuscateDir(ctx context.Context, dir, outDir string, options Options) (*Stats, error) {
+	inputs, err := ListGoFiles(dir, options.IncludeTests, options.Log)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no .go files found in %s", dir)
+	}
+	if !options.DryRun {
+		if err := PrepareOutputDir(outDir); err != nil {
+			return nil, err
+		}
+	}
+	outputs := make([]string, len(inputs))
+	for i, path := range inputs {
+		outputs[i] = filepath.Join(outDir, filepath.Base(path))
+	}
+	return Obfuscate(ctx, inputs, outputs, options)
 }
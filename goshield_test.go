@@ -0,0 +1,558 @@
+package goshield
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testProgram = `package main
+
+import "fmt"
+
+type counter struct{ hits int }
+
+func (c *counter) add(n int) { c.hits += n }
+
+func main() {
+	c := &counter{}
+	for i := 0; i < 42; i++ {
+		c.add(i)
+	}
+	fmt.Println("hits:", c.hits)
+}
+`
+
+// writeInput writes src to a file of a fresh temp dir and returns its path.
+func writeInput(t testing.TB, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Each call keeps its own state, so runs with one seed agree however many of
+// them overlap.
+func TestObfuscateConcurrent(t *testing.T) {
+	input := writeInput(t, testProgram)
+	dir := t.TempDir()
+	options := DefaultOptions()
+	options.Seed = "concurrent"
+
+	outputs := make([]string, 8)
+	errs := make([]error, len(outputs))
+	var wg sync.WaitGroup
+	for i := range outputs {
+		outputs[i] = filepath.Join(dir, strconv.Itoa(i)+".go")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = Obfuscate(context.Background(), []string{input}, outputs[i:i+1], options)
+		}(i)
+	}
+	wg.Wait()
+
+	var first []byte
+	for i, path := range outputs {
+		if errs[i] != nil {
+			t.Fatalf("run %d: %v", i, errs[i])
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = got
+		} else if string(got) != string(first) {
+			t.Errorf("run %d differs from run 0", i)
+		}
+	}
+}
+
+// A context cancelled before the run or as a stage starts stops the run
+// before anything is written.
+func TestObfuscateCancelled(t *testing.T) {
+	input := writeInput(t, testProgram)
+	for _, stage := range []string{"", "parse", "ints", "strings"} {
+		dir := t.TempDir()
+		ctx, cancel := context.WithCancel(context.Background())
+		options := DefaultOptions()
+		options.MapOut = filepath.Join(dir, "map.json")
+		options.Progress = func(name string, done, total int) {
+			if name == stage {
+				cancel()
+			}
+		}
+		if stage == "" {
+			cancel()
+		}
+		_, err := Obfuscate(ctx, []string{input}, []string{filepath.Join(dir, "out.go")}, options)
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled at %q: got error %v, want context.Canceled", stage, err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			t.Errorf("cancelled at %q: wrote %s", stage, entry.Name())
+		}
+	}
+}
+
+// A name declared as two kinds counts under both in Stats.ByKind.
+func TestStatsByKind(t *testing.T) {
+	input := writeInput(t, `package main
+
+func value() int { return 42 }
+
+func main() {
+	value := value()
+	println(value)
+}
+`)
+	options := DefaultOptions()
+	options.Seed = "kinds"
+	options.DryRun = true
+	stats, err := Obfuscate(context.Background(), []string{input}, []string{""}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Renamed != 1 {
+		t.Fatalf("renamed %d names, want 1 (value)", stats.Renamed)
+	}
+	if stats.ByKind["func"] != 1 || stats.ByKind["var"] != 1 {
+		t.Errorf("by kind %v, want value as a func and as a var", stats.ByKind)
+	}
+}
+
+// A -map-in map that renamed a name this run must keep stops the run at the
+// name, with nothing written.
+func TestMapInConflicts(t *testing.T) {
+	for _, tc := range []struct {
+		name, kept, reason, src string
+		fields                  bool
+	}{
+		{"linkname", "nanotime", "it is named by //go:linkname", `package main
+
+import _ "unsafe"
+
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+func main() { println(nanotime() > 0) }
+`, false},
+		{"reflect", "Total", "it is looked up by FieldByName", `package main
+
+import "reflect"
+
+type invoice struct{ Total int }
+
+func main() {
+	println(reflect.ValueOf(invoice{Total: 3}).FieldByName("Total").Int())
+}
+`, false},
+		{"protobuf", "Amount", "protobuf needs it unchanged", `package main
+
+type Payment struct {
+	Amount int64 ` + "`protobuf:\"varint,1,opt,name=amount,proto3\"`" + `
+}
+
+func main() { println(Payment{Amount: 5}.Amount) }
+`, false},
+		{"fields", "Grow", "the field hides a method of an embedded type", `package main
+
+import "bytes"
+
+type buffer struct {
+	*bytes.Buffer
+	Grow bool
+}
+
+func main() {
+	b := buffer{Buffer: new(bytes.Buffer), Grow: true}
+	println(b.Grow)
+}
+`, true},
+	} {
+		dir := t.TempDir()
+		options := DefaultOptions()
+		options.MapIn = filepath.Join(dir, "map.json")
+		options.Fields = tc.fields
+		saved := `{"names": {"` + tc.kept + `": "renamedEarlier"}, "methods": []}`
+		if err := os.WriteFile(options.MapIn, []byte(saved), 0644); err != nil {
+			t.Fatal(err)
+		}
+		input := writeInput(t, tc.src)
+		output := filepath.Join(dir, "out.go")
+		_, err := Obfuscate(context.Background(), []string{input}, []string{output}, options)
+		if err == nil || !strings.Contains(err.Error(), input+":") ||
+			!strings.Contains(err.Error(), tc.kept+" was renamed to renamedEarlier by an earlier run; "+tc.reason) {
+			t.Errorf("%s: got error %v, want %s kept at its position", tc.name, err, tc.kept)
+		}
+		if _, err := os.Stat(output); err == nil {
+			t.Errorf("%s: wrote %s", tc.name, output)
+		}
+	}
+}
+
+// Input that doesn't type-check is refused unless SkipTypeCheck or
+// NoTypeCheck lets it through.
+func TestTypeCheckOptions(t *testing.T) {
+	input := writeInput(t, "package main\n\nfunc main() { println(helper(2)) }\n")
+	for _, set := range []func(*Options){
+		func(o *Options) { o.NoTypeCheck = true },
+		func(o *Options) { o.SkipTypeCheck = true },
+	} {
+		options := DefaultOptions()
+		options.Seed = "typecheck"
+		options.DryRun = true
+		if _, err := Obfuscate(context.Background(), []string{input}, []string{""}, options); err == nil {
+			t.Fatal("input that doesn't type-check was accepted")
+		}
+		set(&options)
+		if _, err := Obfuscate(context.Background(), []string{input}, []string{""}, options); err != nil {
+			t.Errorf("NoTypeCheck %v, SkipTypeCheck %v: %v", options.NoTypeCheck, options.SkipTypeCheck, err)
+		}
+	}
+}
+
+// renamePass renames every identifier spelled from and records the names
+// of the functions it saw.
+type renamePass struct {
+	from, to string
+	funcs    []string
+	err      error
+}
+
+func (p *renamePass) Name() string { return "rename " + p.from }
+
+func (p *renamePass) Apply(files []*ast.File, fset *token.FileSet) error {
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Ident:
+				if n.Name == p.from {
+					n.Name = p.to
+				}
+			case *ast.FuncDecl:
+				p.funcs = append(p.funcs, n.Name.Name)
+			}
+			return true
+		})
+	}
+	return p.err
+}
+
+// A custom pass runs after the built-in renaming, and an error it returns
+// is reported under its name with nothing written.
+func TestPasses(t *testing.T) {
+	input := writeInput(t, `package main
+
+func helper() string { return "hello" }
+
+func main() {
+	greeting := helper()
+	println(greeting)
+}
+`)
+	output := filepath.Join(t.TempDir(), "out.go")
+	pass := &renamePass{from: "greeting", to: "renamedByPass"}
+	options := DefaultOptions()
+	options.Seed = "passes"
+	options.NoVars = true
+	options.Passes = []Pass{pass}
+	if _, err := Obfuscate(context.Background(), []string{input}, []string{output}, options); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "renamedByPass") || strings.Contains(string(out), "greeting") {
+		t.Errorf("the pass did not rename greeting:\n%s", out)
+	}
+	if len(pass.funcs) != 2 || pass.funcs[0] == "helper" || pass.funcs[1] != "main" {
+		t.Errorf("the pass saw funcs %v, want helper renamed and main", pass.funcs)
+	}
+
+	failing := &renamePass{from: "greeting", to: "renamedByPass", err: errors.New("refused")}
+	options.Passes = []Pass{failing}
+	output = filepath.Join(t.TempDir(), "out.go")
+	_, err = Obfuscate(context.Background(), []string{input}, []string{output}, options)
+	if err == nil || !strings.Contains(err.Error(), "rename greeting: refused") {
+		t.Errorf("got error %v, want the pass error under its name", err)
+	}
+	if _, err := os.Stat(output); err == nil {
+		t.Errorf("wrote %s after the pass failed", output)
+	}
+}
+
+// The names of what -watermark, -tamper-check and -expire add are
+// unexported, whatever the seed, so they don't widen the package API.
+func TestAddedNamesUnexported(t *testing.T) {
+	input := writeInput(t, `package main
+
+const banner = "guarded banner"
+
+func main() { println(banner) }
+`)
+	for i := 0; i < 20; i++ {
+		output := filepath.Join(t.TempDir(), "out.go")
+		options := DefaultOptions()
+		options.Seed = strconv.Itoa(i)
+		options.Watermark = "licensee 42"
+		options.TamperCheck = true
+		options.Expire = "2999-01-01"
+		if _, err := Obfuscate(context.Background(), []string{input}, []string{output}, options); err != nil {
+			t.Fatal(err)
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), output, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, spec := range file.Imports {
+			names = append(names, spec.Name.Name)
+		}
+		for _, decl := range file.Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.VAR {
+				for _, spec := range genDecl.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						names = append(names, name.Name)
+					}
+				}
+			}
+		}
+		seen := make(map[string]bool)
+		for _, name := range names {
+			if ast.IsExported(name) || seen[name] {
+				t.Errorf("seed %d: added name %s is exported or not unique", i, name)
+			}
+			seen[name] = true
+		}
+	}
+}
+
+// treeChunk returns declarations numbered i, for inputs of any size.
+func treeChunk(i int) string {
+	return fmt.Sprintf(`
+type record%[1]d struct {
+	name  string
+	count int
+}
+
+func (r *record%[1]d) describe() string {
+	return fmt.Sprintf("record %%s holds %%d entries", r.name, r.count+%[1]d)
+}
+
+func build%[1]d(n int) []record%[1]d {
+	var records []record%[1]d
+	for i := 0; i < n; i++ {
+		records = append(records, record%[1]d{name: "generated record", count: i * 1000})
+	}
+	return records
+}
+`, i)
+}
+
+// writeTree writes a package of n files to a fresh temp dir and returns
+// their paths with output paths in another.
+func writeTree(t testing.TB, n int) (inputs, outputs []string) {
+	t.Helper()
+	in, out := t.TempDir(), t.TempDir()
+	for i := 0; i < n; i++ {
+		src := "package main\n\nimport \"fmt\"\n" + treeChunk(i)
+		if i == 0 {
+			src += "\nfunc main() { fmt.Println(build0(3)[2].describe()) }\n"
+		}
+		name := fmt.Sprintf("file%d.go", i)
+		if err := os.WriteFile(filepath.Join(in, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, filepath.Join(in, name))
+		outputs = append(outputs, filepath.Join(out, name))
+	}
+	return inputs, outputs
+}
+
+// Files encoded in parallel come out as they do one at a time.
+func TestObfuscateJobs(t *testing.T) {
+	inputs, serial := writeTree(t, 16)
+	_, parallel := writeTree(t, 16)
+	options := DefaultOptions()
+	options.Seed = "jobs"
+	options.Jobs = 1
+	if _, err := Obfuscate(context.Background(), inputs, serial, options); err != nil {
+		t.Fatal(err)
+	}
+	options.Jobs = 8
+	if _, err := Obfuscate(context.Background(), inputs, parallel, options); err != nil {
+		t.Fatal(err)
+	}
+	for i := range inputs {
+		want, err := os.ReadFile(serial[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(parallel[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s differs with -j 8", filepath.Base(inputs[i]))
+		}
+	}
+}
+
+// The final stage on one worker and on GOMAXPROCS of them, over a tree of
+// 200 files.
+func BenchmarkObfuscateJobs(b *testing.B) {
+	inputs, outputs := writeTree(b, 200)
+	for _, run := range []struct {
+		name string
+		jobs int
+	}{{"serial", 1}, {"parallel", runtime.GOMAXPROCS(0)}} {
+		b.Run(run.name, func(b *testing.B) {
+			options := DefaultOptions()
+			options.Seed = "bench"
+			options.Jobs = run.jobs
+			for i := 0; i < b.N; i++ {
+				if _, err := Obfuscate(context.Background(), inputs, outputs, options); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// largeFile returns a program of about 1.5 MB.
+func largeFile() string {
+	var src strings.Builder
+	src.WriteString("package main\n\nimport \"fmt\"\n")
+	for i := 0; i < 4000; i++ {
+		src.WriteString(treeChunk(i))
+	}
+	src.WriteString("\nfunc main() { fmt.Println(build0(3)[2].describe()) }\n")
+	return src.String()
+}
+
+// A whole run over one large file, reporting allocations.
+func BenchmarkObfuscateLargeFile(b *testing.B) {
+	input := writeInput(b, largeFile())
+	output := filepath.Join(b.TempDir(), "out.go")
+	options := DefaultOptions()
+	options.Seed = "bench"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Obfuscate(context.Background(), []string{input}, []string{output}, options); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The string pass alone over one large file, reporting allocations.
+func BenchmarkStringsInText(b *testing.B) {
+	text := largeFile()
+	options := DefaultOptions()
+	inConst := constLines(text)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		e := &textEncoder{opts: &options, rng: rand.New(rand.NewSource(1))}
+		if err := e.obfuscateStringsInText(strings.NewReader(text), io.Discard, nil, inConst); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Fed a line at a time, literalScanner finds the literals go/scanner finds in
+// the whole file.
+func TestLiteralScanner(t *testing.T) {
+	paths, err := filepath.Glob("testdata/roundtrip/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := append([]string{}, fuzzSeeds...)
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, string(src))
+	}
+	for n, src := range sources {
+		_, want := stringLiterals(src)
+		var got [][]int
+		var literals literalScanner
+		offset := 0
+		for _, line := range strings.SplitAfter(src, "\n") {
+			for _, loc := range literals.quoted(strings.TrimSuffix(line, "\n")) {
+				got = append(got, []int{offset + loc[0], offset + loc[1]})
+			}
+			offset += len(line)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("source %d: got literals at %v, want %v", n, got, want)
+		}
+	}
+}
+
+// fuzzSeeds cover the syntax the text passes are most likely to mangle.
+var fuzzSeeds = []string{
+	testProgram,
+	"package main\n\n// #include <stdio.h>\nimport \"C\"\n\nfunc main() { C.puts(C.CString(\"hello\")) }\n",
+	"package main\n\ntype Number interface{ ~int | ~float64 }\n\nfunc Sum[T Number](xs ...T) T {\n\tvar total T\n\tfor _, x := range xs {\n\t\ttotal += x\n\t}\n\treturn total\n}\n\ntype Pair[K comparable, V any] struct {\n\tKey K\n\tValue V\n}\n\nfunc main() { println(Sum(1, 2, 3), Pair[string, int]{\"a\", 1}.Value) }\n",
+	"package main\n\ntype Weekday int\n\nconst (\n\tSunday Weekday = iota\n\tMonday\n\t_\n\tWednesday = iota * 10\n)\n\nconst greeting = \"hello\" + \" world\"\n\nfunc main() { println(Sunday, Monday, Wednesday, greeting) }\n",
+	"//go:build linux && !386\n// +build linux,!386\n\npackage main\n\nfunc main() { println(\"linux only\") }\n",
+	"package main\n\nvar script = `function run() { return \"quoted\" + 'single'; }`\n\nvar tag struct {\n\tName string `json:\"name\"`\n}\n\nfunc main() { println(script, `raw \\n \"text\"`, len(tag.Name)) }\n",
+}
+
+// The output of Obfuscate must parse for every input that does.
+func FuzzObfuscate(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		if _, err := parser.ParseFile(token.NewFileSet(), "in.go", src, 0); err != nil {
+			t.Skip()
+		}
+		input := writeInput(t, src)
+		output := filepath.Join(t.TempDir(), "out.go")
+		options := DefaultOptions()
+		options.Seed = "fuzz"
+		options.SkipTypeCheck = true
+		if _, err := Obfuscate(context.Background(), []string{input}, []string{output}, options); err != nil {
+			// A pass refusing a construct points at it in the input,
+			// any other error is a bug
+			for _, line := range strings.Split(err.Error(), "\n") {
+				if !strings.Contains(line, input+":") {
+					t.Fatalf("Obfuscate: %v", err)
+				}
+			}
+			t.Skip(err)
+		}
+		got, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), "out.go", got, 0); err != nil {
+			t.Fatalf("output does not parse: %v\n%s", err, got)
+		}
+	})
+}
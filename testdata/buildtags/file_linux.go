@@ -0,0 +1,11 @@
+package main
+
+var platformName = "linux"
+
+type device struct{}
+
+func (device) openDevice() string { return "/dev/null" }
+
+func helper() string { return "on " + platformName }
+
+func init() { order = append(order, "linux") }
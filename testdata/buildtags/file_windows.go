@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import "fmt"
+
+var platformName = "windows"
+
+type device struct{ handle uintptr }
+
+func (d device) openDevice() string { return fmt.Sprint("NUL", d.handle) }
+
+func helper() string { return "on " + platformName }
@@ -0,0 +1,19 @@
+// Two build variants of one package: file_linux.go, selected by its name,
+// and file_windows.go, selected by its //go:build line, declare the same
+// names. Several init functions share main.go.
+package main
+
+import "fmt"
+
+type opener interface{ openDevice() string }
+
+var order []string
+
+func init() { order = append(order, "first") }
+
+func init() { order = append(order, "second") }
+
+func main() {
+	var d opener = device{}
+	fmt.Println(helper(), order, platformName, d.openDevice())
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+// Level is printed through the generated String method in gen.go
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Error
+)
+
+func main() {
+	for _, level := range []Level{Debug, Info, Error, 7} {
+		fmt.Println(level)
+	}
+}
@@ -0,0 +1,13 @@
+// Package main is a small demo.
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+	fmt.Println(shout(greeting()))
+}
+
+func shout(s string) string { return strings.ToUpper(s) }
@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+type greeter struct{ name string }
+
+func (g *greeter) hello() string { return fmt.Sprintf("hello %s", g.name) }
+
+func greeting() string { return (&greeter{name: "world"}).hello() }
@@ -0,0 +1,4 @@
+package main
+
+// shout is also declared in a.go, so a.go and clash.go can't be merged.
+func shout(s string) string { return s + "!" }
@@ -0,0 +1,41 @@
+// Command passes obfuscates the file named by its first argument into the
+// second with goshield.Obfuscate and a custom pass, so testdata/roundtrip.sh
+// can check that Options.Passes run: the pass renames every identifier
+// spelled greeting.
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+
+	"github.com/rafaelwdornelas/goshield"
+)
+
+type renamePass struct{ from, to string }
+
+func (p renamePass) Name() string { return "rename " + p.from }
+
+func (p renamePass) Apply(files []*ast.File, fset *token.FileSet) error {
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && ident.Name == p.from {
+				ident.Name = p.to
+			}
+			return true
+		})
+	}
+	return nil
+}
+
+func main() {
+	options := goshield.DefaultOptions()
+	options.NoVars = true
+	options.Passes = []goshield.Pass{renamePass{from: "greeting", to: "renamedByPass"}}
+	if _, err := goshield.Obfuscate(context.Background(), os.Args[1:2], os.Args[2:3], options); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
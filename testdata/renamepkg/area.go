@@ -0,0 +1,4 @@
+package shapes
+
+// Area is the area of a rectangle.
+func Area(w, h int) int { return w * h }
@@ -0,0 +1,13 @@
+package shapes_test
+
+import (
+	"testing"
+
+	"example.com/shapes"
+)
+
+func TestSquare(t *testing.T) {
+	if got := shapes.Square(3); got != 9 {
+		t.Errorf("Square(3) = %d, want 9", got)
+	}
+}
@@ -0,0 +1,4 @@
+package shapes
+
+// Square is the area of a square, through Area in area.go.
+func Square(side int) int { return Area(side, side) }
@@ -0,0 +1,1222 @@
+#!/usr/bin/env bash
+# Round-trip check: every testdata/roundtrip/<case>.go is obfuscated, built in
+# a scratch module and run. Its output must match <case>.golden and its exit
+# code must match the original program's. An optional <case>.flags file holds
+# extra goshield flags for that case, and a <case>/ directory the files it
+# embeds. The checks after the loop cover what a single program can't show:
+# whole directories, flags that change what is written, and failing runs.
+# Each one says what it checks in the comment above it.
+#
+# Usage: testdata/roundtrip.sh [goshield flags applied to every case]
+#        testdata/roundtrip.sh -update   (rewrite .golden from the originals)
+
+set -u
+root=$(cd "$(dirname "$0")/.." && pwd)
+cases="$root/testdata/roundtrip"
+work=$(mktemp -d)
+trap 'rm -rf "$work"' EXIT
+
+(cd "$root" && go build -o "$work/goshield" ./cmd/goshield) || exit 1
+
+# run <dir> <file>: runs a single-file program, prints its output and exit code
+run() {
+	(cd "$1" && go run "$2" 2>&1)
+	echo "exit: $?"
+}
+
+# jsonnum <key>: reads one JSON object from stdin and prints its top-level
+# number <key>; fails on anything else, trailing data included
+mkdir -p "$work/jsonnum"
+cat > "$work/jsonnum/main.go" <<'EOF'
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+func main() {
+	var object map[string]interface{}
+	dec := json.NewDecoder(os.Stdin)
+	if err := dec.Decode(&object); err != nil || dec.More() {
+		fmt.Fprintln(os.Stderr, "not one JSON object:", err)
+		os.Exit(1)
+	}
+	n, ok := object[os.Args[1]].(float64)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "no number %q\n", os.Args[1])
+		os.Exit(1)
+	}
+	fmt.Println(n)
+}
+EOF
+(cd "$work/jsonnum" && printf 'module jsonnum\n\ngo 1.21\n' > go.mod && go build -o ../jsonnum.bin .) || exit 1
+jsonnum() {
+	"$work/jsonnum.bin" "$1"
+}
+
+update=false
+if [ "${1:-}" = "-update" ]; then
+	update=true
+	shift
+fi
+
+failed=0
+for src in "$cases"/*.go; do
+	name=$(basename "$src" .go)
+	dir="$work/$name"
+	mkdir -p "$dir"
+	printf 'module roundtrip\n\ngo 1.21\n' > "$dir/go.mod"
+
+	cp "$src" "$dir/original.go"
+	# files the case embeds live in a directory named after it
+	if [ -d "$cases/$name" ]; then
+		cp -r "$cases/$name/." "$dir/"
+	fi
+	want=$(run "$dir" original.go)
+	if $update; then
+		printf '%s\n' "$want" > "$cases/$name.golden"
+		continue
+	fi
+	if [ "$want" != "$(cat "$cases/$name.golden")" ]; then
+		echo "FAIL $name: original output differs from $name.golden"
+		failed=1
+		continue
+	fi
+
+	flags=()
+	if [ -f "$cases/$name.flags" ]; then
+		read -r -a flags < "$cases/$name.flags"
+	fi
+	if ! "$work/goshield" -i "$src" -o "$dir/main.go" -seed "$name" ${flags[@]+"${flags[@]}"} "$@" > "$dir/log.txt" 2>&1; then
+		echo "FAIL $name: goshield failed"
+		tail -n 5 "$dir/log.txt"
+		failed=1
+		continue
+	fi
+	rm "$dir/original.go"
+
+	got=$(run "$dir" main.go)
+	if [ "$got" != "$want" ]; then
+		echo "FAIL $name"
+		diff <(printf '%s\n' "$want") <(printf '%s\n' "$got") | head -n 10
+		failed=1
+		continue
+	fi
+	echo "ok   $name"
+done
+
+# Encoding files in parallel must give the same output as one at a time.
+# The cases don't form a buildable package, only the text is compared, so
+# -skip-typecheck lets them through. The parallel run spells the flag
+# -jobs, its long name.
+if ! $update; then
+	ran=true
+	for jobs in 1 8; do
+		name=-j
+		if [ "$jobs" -gt 1 ]; then
+			name=-jobs
+		fi
+		"$work/goshield" -dir "$cases" -o "$work/parallel-$jobs" -seed parallel "$name" "$jobs" -skip-typecheck "$@" > "$work/parallel-$jobs.txt" 2>&1 || ran=false
+	done
+	if ! $ran; then
+		echo "FAIL parallel: goshield failed"
+		tail -n 5 "$work/parallel-8.txt"
+		failed=1
+	elif diff -r "$work/parallel-1" "$work/parallel-8" > /dev/null; then
+		echo "ok   parallel"
+	else
+		echo "FAIL parallel: -jobs 8 output differs from -j 1"
+		failed=1
+	fi
+fi
+
+# A watermark survives obfuscation and is read back from the output.
+if ! $update; then
+	mark="licensee 42 / build 7"
+	mkdir -p "$work/watermark"
+	if ! "$work/goshield" -i "$cases/ints.go" -o "$work/watermark/main.go" -seed watermark -watermark "$mark" "$@" > "$work/watermark.txt" 2>&1; then
+		echo "FAIL watermark: goshield failed"
+		tail -n 5 "$work/watermark.txt"
+		failed=1
+	elif [ "$("$work/goshield" -extract-watermark -i "$work/watermark/main.go" 2>&1)" = "$mark" ]; then
+		echo "ok   watermark"
+	else
+		echo "FAIL watermark: extracted text differs"
+		failed=1
+	fi
+fi
+
+# With -salt, the same file under two paths obfuscates differently, and the
+# same path and salt twice gives the same output.
+if ! $update; then
+	for copy in a b; do
+		mkdir -p "$work/salt/$copy"
+		cp "$cases/ints.go" "$work/salt/$copy/main.go"
+	done
+	ran=true
+	for run in a/out1 a/out2 b/out1; do
+		"$work/goshield" -i "$work/salt/${run%/*}/main.go" -o "$work/salt/$run.go" -seed salt -salt tree "$@" > /dev/null 2>&1 || ran=false
+	done
+	if ! $ran; then
+		echo "FAIL salt: goshield failed"
+		failed=1
+	elif ! cmp -s "$work/salt/a/out1.go" "$work/salt/a/out2.go"; then
+		echo "FAIL salt: same input and salt gave different outputs"
+		failed=1
+	elif cmp -s "$work/salt/a/out1.go" "$work/salt/b/out1.go"; then
+		echo "FAIL salt: identical files under two paths gave the same output"
+		failed=1
+	else
+		echo "ok   salt"
+	fi
+fi
+
+# A run that fails after parsing writes nothing, not even the generated file
+# it copies through. The missing -tamper-handler fails the collect stage, so
+# the user's flags are left out.
+if ! $update; then
+	mkdir -p "$work/partial/in"
+	printf '// Code generated by hand. DO NOT EDIT.\n\npackage main\n\nconst generated = 1\n' > "$work/partial/in/gen.go"
+	printf 'package main\n\nfunc main() { println(generated) }\n' > "$work/partial/in/main.go"
+	if "$work/goshield" -dir "$work/partial/in" -o "$work/partial/out" -seed partial -tamper-check -tamper-handler missing > "$work/partial.txt" 2>&1; then
+		echo "FAIL partial: goshield accepted a missing -tamper-handler"
+		failed=1
+	elif [ -n "$(ls -A "$work/partial/out")" ]; then
+		echo "FAIL partial: the failed run left files behind:" $(ls -A "$work/partial/out")
+		failed=1
+	else
+		echo "ok   partial"
+	fi
+fi
+
+# Changing a guarded constant in the obfuscated output calls the handler:
+# -no-strings keeps the literal where sed can find it. A file with no string
+# constants has nothing to guard and is refused.
+if ! $update; then
+	mkdir -p "$work/tampered"
+	printf 'module x\n\ngo 1.21\n' > "$work/tampered/go.mod"
+	if ! "$work/goshield" -i "$cases/tamper.go" -o "$work/tampered/main.go" -seed tampered -tamper-check -tamper-handler onTamper -no-strings "$@" > /dev/null 2>&1 ||
+		! (cd "$work/tampered" && go build -o before . 2>&1); then
+		echo "FAIL tampered: goshield or go build failed"
+		failed=1
+	else
+		sed -i 's/"tamper-checked build"/"tampered build"/' "$work/tampered/main.go"
+		(cd "$work/tampered" && go build -o after . 2>&1)
+		before=$("$work/tampered/before" 2>&1; echo "exit: $?")
+		after=$("$work/tampered/after" 2>&1; echo "exit: $?")
+		if [ "$before" != "$(printf 'tamper-checked build info 3 ACME-1234\nexit: 0')" ]; then
+			echo "FAIL tampered: the unmodified build printed" $before
+			failed=1
+		elif [ "$after" != "$(printf 'modified\nexit: 3')" ]; then
+			echo "FAIL tampered: the modified build printed" $after
+			failed=1
+		else
+			echo "ok   tampered"
+		fi
+	fi
+	mkdir -p "$work/unguarded/in"
+	printf 'package main\n\nfunc main() { println(1) }\n' > "$work/unguarded/in/main.go"
+	if "$work/goshield" -dir "$work/unguarded/in" -o "$work/unguarded/out" -seed unguarded -tamper-check > "$work/unguarded.txt" 2>&1; then
+		echo "FAIL unguarded: goshield accepted -tamper-check with no string constants"
+		failed=1
+	elif ! grep -q 'no package-level string constants' "$work/unguarded.txt"; then
+		echo "FAIL unguarded: unexpected error:" $(cat "$work/unguarded.txt")
+		failed=1
+	elif [ -n "$(ls -A "$work/unguarded/out" 2>/dev/null)" ]; then
+		echo "FAIL unguarded: the failed run left files behind"
+		failed=1
+	else
+		echo "ok   unguarded"
+	fi
+fi
+
+# -integrity guards only the constants between its markers: the output
+# still runs after gofmt, editing a constant inside the region calls the
+# handler and editing one outside does not. An input without a region is
+# refused.
+if ! $update; then
+	mkdir -p "$work/integrity"
+	printf 'module x\n\ngo 1.21\n' > "$work/integrity/go.mod"
+	if ! "$work/goshield" -i "$cases/integrity.go" -o "$work/integrity/main.go" -seed integrity -integrity -tamper-handler onTamper -no-strings "$@" > /dev/null 2>&1; then
+		echo "FAIL integrity: goshield failed"
+		failed=1
+	else
+		cp "$work/integrity/main.go" "$work/integrity.go"
+		gofmt -w "$work/integrity/main.go"
+		(cd "$work/integrity" && go build -o formatted . 2>&1)
+		sed 's/"ACME-5678-INTEGRITY"/"ACME-0000-INTEGRITY"/' "$work/integrity.go" > "$work/integrity/main.go"
+		(cd "$work/integrity" && go build -o inside . 2>&1)
+		sed 's/"build 17"/"build 18"/' "$work/integrity.go" > "$work/integrity/main.go"
+		(cd "$work/integrity" && go build -o outside . 2>&1)
+		formatted=$("$work/integrity/formatted" 2>&1; echo "exit: $?")
+		inside=$("$work/integrity/inside" 2>&1; echo "exit: $?")
+		outside=$("$work/integrity/outside" 2>&1; echo "exit: $?")
+		if [ "$formatted" != "$(cat "$cases/integrity.golden")" ]; then
+			echo "FAIL integrity: the gofmt-ed build printed" $formatted
+			failed=1
+		elif [ "$inside" != "$(printf 'modified\nexit: 3')" ]; then
+			echo "FAIL integrity: editing a guarded constant printed" $inside
+			failed=1
+		elif [ "$outside" != "$(sed 's/build 17/build 18/' "$cases/integrity.golden")" ]; then
+			echo "FAIL integrity: editing an unguarded constant printed" $outside
+			failed=1
+		elif "$work/goshield" -i "$cases/tamper.go" -o "$work/integrity/none.go" -seed integrity -integrity "$@" > "$work/integrity.txt" 2>&1; then
+			echo "FAIL integrity: goshield accepted -integrity without a marked region"
+			failed=1
+		elif ! grep -q 'no package-level string constants between' "$work/integrity.txt"; then
+			echo "FAIL integrity: unexpected error:" $(cat "$work/integrity.txt")
+			failed=1
+		else
+			echo "ok   integrity"
+		fi
+	fi
+fi
+
+# -o - prints the same code -o writes to a file.
+if ! $update; then
+	mkdir -p "$work/stdout"
+	if ! "$work/goshield" -i "$cases/ints.go" -o "$work/stdout/file.go" -seed stdout "$@" > /dev/null 2>&1 ||
+		! "$work/goshield" -i "$cases/ints.go" -o - -seed stdout "$@" > "$work/stdout/stdout.go" 2> /dev/null; then
+		echo "FAIL stdout: goshield failed"
+		failed=1
+	elif cmp -s "$work/stdout/file.go" "$work/stdout/stdout.go"; then
+		echo "ok   stdout"
+	else
+		echo "FAIL stdout: -o - differs from the file output"
+		failed=1
+	fi
+fi
+
+# The poly case's strings must not all share one encoding style.
+if ! $update && [ -f "$work/poly/main.go" ]; then
+	styles=0
+	for pattern in 'string(rune(' '([]byte{' '(`'; do
+		if grep -qF "$pattern" "$work/poly/main.go"; then
+			styles=$((styles + 1))
+		fi
+	done
+	if [ "$styles" -ge 2 ]; then
+		echo "ok   poly styles"
+	else
+		echo "FAIL poly styles: only $styles string encoding style in the output"
+		failed=1
+	fi
+fi
+
+# Turning passes off lowers the -score total.
+if ! $update; then
+	mkdir -p "$work/score"
+	full=$("$work/goshield" -i "$cases/ints.go" -o "$work/score/full.go" -seed score -score -json "$@" 2> /dev/null | sed -n 's/^ *"total": \([0-9]*\),$/\1/p')
+	reduced=$("$work/goshield" -i "$cases/ints.go" -o "$work/score/reduced.go" -seed score -score -json -no-vars -no-functions -no-ints "$@" 2> /dev/null | sed -n 's/^ *"total": \([0-9]*\),$/\1/p')
+	if [ -z "$full" ] || [ -z "$reduced" ]; then
+		echo "FAIL score: no score in the -json summary"
+		failed=1
+	elif [ "$full" -gt "$reduced" ]; then
+		echo "ok   score"
+	else
+		echo "FAIL score: full run scored $full, reduced run $reduced"
+		failed=1
+	fi
+fi
+
+# Small duration counts are transformed in vars but left alone in consts.
+if ! $update && [ -f "$work/durations/main.go" ]; then
+	if ! grep -q '= 5 \* ' "$work/durations/main.go"; then
+		echo "FAIL durations: the const count was changed"
+		failed=1
+	elif grep -q '= 3 \* \|:= 4 \* \|(7)' "$work/durations/main.go"; then
+		echo "FAIL durations: a var count was left readable"
+		failed=1
+	else
+		echo "ok   durations"
+	fi
+fi
+
+# Test files: skipped with a warning by default, obfuscated along with the
+# package by -include-tests. The example keeps its name and so do the type
+# and method it documents, or vet would reject it.
+if ! $update; then
+	mkdir -p "$work/tests/in"
+	printf 'module tests\n\ngo 1.21\n' > "$work/tests/in/go.mod"
+	printf 'package main\n\nfunc double(n int) int { return n * 2 }\n\ntype Doubler struct{}\n\nfunc (Doubler) Twice(n int) int { return double(n) }\n\nfunc main() { println(Doubler{}.Twice(21)) }\n' > "$work/tests/in/main.go"
+	printf 'package main\n\nimport (\n\t"fmt"\n\t"testing"\n)\n\nfunc TestDouble(t *testing.T) {\n\tif double(21) != 42 {\n\t\tt.Fatal("double")\n\t}\n}\n\nfunc ExampleDoubler_Twice() {\n\tfmt.Println(Doubler{}.Twice(21))\n\t// Output: 42\n}\n' > "$work/tests/in/main_test.go"
+	if ! "$work/goshield" -dir "$work/tests/in" -o "$work/tests/skip" -seed tests "$@" > "$work/tests/skip.txt" 2>&1; then
+		echo "FAIL tests: goshield failed without -include-tests"
+		failed=1
+	elif [ -e "$work/tests/skip/main_test.go" ]; then
+		echo "FAIL tests: main_test.go written without -include-tests"
+		failed=1
+	elif ! grep -q 'internal tests (main_test.go)' "$work/tests/skip.txt"; then
+		echo "FAIL tests: no warning about the skipped internal test"
+		failed=1
+	elif ! "$work/goshield" -dir "$work/tests/in" -o "$work/tests/out" -seed tests -include-tests "$@" > "$work/tests/include.txt" 2>&1; then
+		echo "FAIL tests: goshield failed with -include-tests"
+		failed=1
+	elif cp "$work/tests/in/go.mod" "$work/tests/out/" && ! (cd "$work/tests/out" && go test > ../test.txt 2>&1); then
+		echo "FAIL tests: go test fails on the obfuscated package"
+		tail -n 5 "$work/tests/test.txt"
+		failed=1
+	elif ! grep -q 'func ExampleDoubler_Twice()' "$work/tests/out/main_test.go"; then
+		echo "FAIL tests: the example was renamed"
+		failed=1
+	elif grep -qw 'double' "$work/tests/out/main.go"; then
+		echo "FAIL tests: double was not renamed"
+		failed=1
+	else
+		echo "ok   tests"
+	fi
+fi
+
+# Build variants declaring the same names are renamed alike, so every
+# variant still builds.
+if ! $update; then
+	mkdir -p "$work/buildtags/in"
+	cp "$root/testdata/buildtags/"*.go "$work/buildtags/in/"
+	printf 'module buildtags\n\ngo 1.21\n' > "$work/buildtags/in/go.mod"
+	want=$(cd "$work/buildtags/in" && go run . 2>&1)
+	if ! "$work/goshield" -dir "$work/buildtags/in" -o "$work/buildtags/out" -seed buildtags "$@" > "$work/buildtags.txt" 2>&1; then
+		echo "FAIL buildtags: goshield failed"
+		tail -n 5 "$work/buildtags.txt"
+		failed=1
+	else
+		out="$work/buildtags/out"
+		cp "$work/buildtags/in/go.mod" "$out/"
+		if [ "$(grep -o '^func [^ (]*() string' "$out/file_linux.go")" != "$(grep -o '^func [^ (]*() string' "$out/file_windows.go")" ]; then
+			echo "FAIL buildtags: the variants name helper differently"
+			failed=1
+		elif [ "$(cd "$out" && go run . 2>&1)" != "$want" ]; then
+			echo "FAIL buildtags: output differs"
+			failed=1
+		elif ! (cd "$out" && GOOS=windows go vet . > /dev/null 2>&1); then
+			echo "FAIL buildtags: the windows variant doesn't build"
+			failed=1
+		else
+			echo "ok   buildtags"
+		fi
+	fi
+fi
+
+# A receiver named like a field of its type is renamed too.
+if ! $update && [ -f "$work/receivers/main.go" ]; then
+	if grep -q '^func (c ' "$work/receivers/main.go"; then
+		echo "FAIL receivers: receiver c kept its name"
+		failed=1
+	else
+		echo "ok   receivers names"
+	fi
+fi
+
+# -split parts build together, and parts of a file_linux.go keep its
+# constraint.
+if ! $update; then
+	mkdir -p "$work/split/tags" "$work/split/one"
+	printf 'module split\n\ngo 1.21\n' > "$work/split/go.mod"
+	cp "$root/testdata/buildtags/"*.go "$work/split/tags/"
+	cp "$work/split/go.mod" "$work/split/tags/"
+	if ! "$work/goshield" -i "$cases/receivers.go" -o "$work/split/one/main.go" -seed split -split 3 "$@" > "$work/split.txt" 2>&1 ||
+		! "$work/goshield" -dir "$work/split/tags" -o "$work/split/tagsout" -seed split -split 2 "$@" >> "$work/split.txt" 2>&1; then
+		echo "FAIL split: goshield failed"
+		tail -n 5 "$work/split.txt"
+		failed=1
+	else
+		cp "$work/split/go.mod" "$work/split/one/"
+		cp "$work/split/go.mod" "$work/split/tagsout/"
+		if [ "$(ls "$work/split/one" | grep -c '\.go$')" != 3 ]; then
+			echo "FAIL split: expected 3 files, got" $(ls "$work/split/one")
+			failed=1
+		elif [ "$(run "$work/split/one" .)" != "$(cat "$cases/receivers.golden")" ]; then
+			echo "FAIL split: the split receivers case runs differently"
+			failed=1
+		elif [ "$(run "$work/split/tagsout" .)" != "$(run "$work/split/tags" .)" ] ||
+			! (cd "$work/split/tagsout" && GOOS=windows go vet . > /dev/null 2>&1); then
+			echo "FAIL split: the split build variants don't build alike"
+			failed=1
+		else
+			echo "ok   split"
+		fi
+	fi
+fi
+
+# -watch runs once at start and once more after a burst of saves. A second
+# watcher with -quiet and -json prints nothing on stderr, only the summary of
+# each run on stdout.
+if ! $update; then
+	mkdir -p "$work/watch" "$work/watchquiet"
+	cp "$cases/receivers.go" "$work/watch/main.go"
+	cp "$cases/receivers.go" "$work/watchquiet/main.go"
+	"$work/goshield" -watch -i "$work/watch/main.go" -o "$work/watch/out.go" -seed watch "$@" > "$work/watch.txt" 2>&1 &
+	watcher=$!
+	"$work/goshield" -watch -quiet -json -i "$work/watchquiet/main.go" -o "$work/watchquiet/out.go" -seed watch "$@" > "$work/watchquiet.json" 2> "$work/watchquiet.txt" &
+	quiet=$!
+	# wait for the first runs, then for the runs after the edits, and a little
+	# longer to catch a run too many
+	for i in $(seq 50); do
+		[ "$(grep -c '\] ok: ' "$work/watch.txt")" -ge 1 ] && [ "$(grep -c '"files":' "$work/watchquiet.json")" -ge 1 ] && break
+		sleep 0.2
+	done
+	for i in 1 2 3; do
+		echo "// edit $i" >> "$work/watch/main.go"
+		echo "// edit $i" >> "$work/watchquiet/main.go"
+		sleep 0.1
+	done
+	for i in $(seq 50); do
+		[ "$(grep -c '\] ok: ' "$work/watch.txt")" -ge 2 ] && [ "$(grep -c '"files":' "$work/watchquiet.json")" -ge 2 ] && break
+		sleep 0.2
+	done
+	sleep 1
+	kill $watcher $quiet
+	wait $watcher $quiet 2> /dev/null
+	runs=$(grep -c '\] ok: ' "$work/watch.txt")
+	if [ "$runs" != 2 ]; then
+		echo "FAIL watch: expected 2 runs, got $runs"
+		tail -n 5 "$work/watch.txt"
+		failed=1
+	elif [ "$(run "$work/watch" out.go)" != "$(cat "$cases/receivers.golden")" ]; then
+		echo "FAIL watch: the output runs differently"
+		failed=1
+	elif [ -s "$work/watchquiet.txt" ]; then
+		echo "FAIL watch: -quiet still logged"
+		head -n 5 "$work/watchquiet.txt"
+		failed=1
+	elif [ "$(grep -c '"files":' "$work/watchquiet.json")" != 2 ]; then
+		echo "FAIL watch: -quiet -json did not print one summary per run"
+		failed=1
+	else
+		echo "ok   watch"
+	fi
+fi
+
+# -keep-imports leaves context and testing as they are, fmt is aliased.
+if ! $update && [ -f "$work/keepimports/main.go" ]; then
+	out="$work/keepimports/main.go"
+	if ! grep -q '^	"testing"$' "$out" || ! grep -q '^	"context"$' "$out" ||
+		! grep -q '\*testing\.T, ' "$out" || ! grep -q ' context\.Context)' "$out"; then
+		echo "FAIL keepimports: a kept import or its selectors were aliased"
+		failed=1
+	elif grep -q '^	"fmt"$' "$out"; then
+		echo "FAIL keepimports: fmt was not aliased"
+		failed=1
+	else
+		echo "ok   keepimports aliases"
+	fi
+fi
+
+# Type switch bindings are renamed, the imported bytes.Buffer is not.
+if ! $update && [ -f "$work/typeswitchbind/main.go" ]; then
+	out="$work/typeswitchbind/main.go"
+	if grep -q 'switch \(data\|v\) :=' "$out"; then
+		echo "FAIL typeswitchbind: a type switch binding kept its name"
+		failed=1
+	elif ! grep -q '^	case \*[^ .]*\.Buffer:$' "$out"; then
+		echo "FAIL typeswitchbind: the bytes.Buffer case was renamed"
+		failed=1
+	else
+		echo "ok   typeswitchbind names"
+	fi
+fi
+
+# A fragment using a name declared elsewhere is refused with the type error
+# and nothing written, and obfuscated anyway with -skip-typecheck or
+# -no-type-check (here as a config key).
+if ! $update; then
+	mkdir -p "$work/typecheck"
+	printf 'package main\n\nfunc main() { println(helper(2)) }\n' > "$work/typecheck/main.go"
+	if "$work/goshield" -i "$work/typecheck/main.go" -o "$work/typecheck/out.go" "$@" > "$work/typecheck.txt" 2>&1 ||
+		[ -e "$work/typecheck/out.go" ]; then
+		echo "FAIL typecheck: input that doesn't type-check was obfuscated"
+		failed=1
+	elif ! grep -q 'undefined: helper' "$work/typecheck.txt" || ! grep -q 'pass -skip-typecheck' "$work/typecheck.txt"; then
+		echo "FAIL typecheck: the type error was not reported"
+		tail -n 5 "$work/typecheck.txt"
+		failed=1
+	elif ! "$work/goshield" -i "$work/typecheck/main.go" -o "$work/typecheck/skip.go" -skip-typecheck "$@" > "$work/typecheck.txt" 2>&1; then
+		echo "FAIL typecheck: -skip-typecheck did not let the fragment through"
+		tail -n 5 "$work/typecheck.txt"
+		failed=1
+	elif printf 'no-type-check: true\n' > "$work/typecheck/config.yaml" &&
+		! "$work/goshield" -i "$work/typecheck/main.go" -o "$work/typecheck/config.go" -config "$work/typecheck/config.yaml" "$@" > "$work/typecheck.txt" 2>&1; then
+		echo "FAIL typecheck: the no-type-check config key did not let the fragment through"
+		tail -n 5 "$work/typecheck.txt"
+		failed=1
+	else
+		echo "ok   typecheck"
+	fi
+fi
+
+# A library package whose exported names get renamed is warned about, one
+# obfuscated with -keep-exported is not.
+if ! $update; then
+	mkdir -p "$work/library"
+	printf 'package shapes\n\nfunc Area(side int) int { return side * side }\n' > "$work/library/shapes.go"
+	"$work/goshield" -i "$work/library/shapes.go" -o "$work/library/out.go" "$@" > "$work/library.txt" 2>&1
+	"$work/goshield" -i "$work/library/shapes.go" -o "$work/library/kept.go" -keep-exported "$@" > "$work/library-kept.txt" 2>&1
+	if ! grep -q 'package shapes is not main.*(Area) are renamed' "$work/library.txt"; then
+		echo "FAIL library: no warning for the renamed API of package shapes"
+		tail -n 5 "$work/library.txt"
+		failed=1
+	elif grep -q 'is not main' "$work/library-kept.txt"; then
+		echo "FAIL library: warned although -keep-exported keeps the API"
+		failed=1
+	else
+		echo "ok   library"
+	fi
+fi
+
+# Logs go to stderr, with -log-json as one JSON object per line, and so does
+# the usage text printed when -i is missing.
+if ! $update; then
+	mkdir -p "$work/logjson"
+	"$work/goshield" -i "$cases/ints.go" -o "$work/logjson/text.go" "$@" > "$work/logjson/text.out" 2> "$work/logjson/text.err"
+	"$work/goshield" -i "$cases/ints.go" -o "$work/logjson/json.go" -log-json -score "$@" > "$work/logjson/json.out" 2> "$work/logjson/json.err"
+	"$work/goshield" -o - "$@" > "$work/logjson/usage.out" 2> "$work/logjson/usage.err"
+	if [ -s "$work/logjson/text.out" ] || [ -s "$work/logjson/json.out" ]; then
+		echo "FAIL logjson: log messages written to stdout"
+		failed=1
+	elif [ -s "$work/logjson/usage.out" ] || ! grep -q '^Usage: goshield' "$work/logjson/usage.err"; then
+		echo "FAIL logjson: the usage text was not written to stderr"
+		failed=1
+	elif grep -qv '^{"time":"[^"]*","level":"\(debug\|info\|error\)","msg":".*}$' "$work/logjson/json.err"; then
+		echo "FAIL logjson: a line is not a JSON log record"
+		grep -v '^{"time"' "$work/logjson/json.err" | head -n 3
+		failed=1
+	elif ! grep -q '"msg":"Score: [0-9]*/100","fields":{"score":{"total":' "$work/logjson/json.err"; then
+		echo "FAIL logjson: the score record has no fields"
+		failed=1
+	else
+		echo "ok   logjson"
+	fi
+fi
+
+# -func-pattern and -type-pattern rename the crypto names only.
+if ! $update && [ -f "$work/patterns/main.go" ]; then
+	out="$work/patterns/main.go"
+	if ! grep -q '^type config struct' "$out" || ! grep -q ') describe() string' "$out" ||
+		! grep -q '^func roundTrip(' "$out"; then
+		echo "FAIL patterns: a name the patterns don't match was renamed"
+		failed=1
+	elif grep -q '^\(func\|type\) .*crypto' "$out"; then
+		echo "FAIL patterns: a matched name kept its spelling"
+		failed=1
+	else
+		echo "ok   patterns names"
+	fi
+fi
+
+# A past -expire date stops the program with the message, a future one
+# changes nothing.
+if ! $update; then
+	mkdir -p "$work/expire/past" "$work/expire/future"
+	if ! "$work/goshield" -i "$cases/ints.go" -o "$work/expire/past/main.go" -expire 2000-01-01 -expire-message "trial over" "$@" > "$work/expire.txt" 2>&1 ||
+		! "$work/goshield" -i "$cases/ints.go" -o "$work/expire/future/main.go" -expire 2999-12-31 "$@" >> "$work/expire.txt" 2>&1; then
+		echo "FAIL expire: goshield failed"
+		tail -n 5 "$work/expire.txt"
+		failed=1
+	elif ! run "$work/expire/past" main.go | tr '\n' ' ' | grep -q '^trial over .*exit: 1 $'; then
+		echo "FAIL expire: the expired program did not stop with the message"
+		run "$work/expire/past" main.go | tail -n 3
+		failed=1
+	elif grep -q 'trial over' "$work/expire/past/main.go"; then
+		echo "FAIL expire: the message is readable in the output"
+		failed=1
+	elif [ "$(run "$work/expire/future" main.go)" != "$(cat "$cases/ints.golden")" ]; then
+		echo "FAIL expire: the program stopped before its -expire date"
+		failed=1
+	else
+		echo "ok   expire"
+	fi
+fi
+
+# An input over -max-file-size is refused before it is parsed, with the limit
+# in the error and nothing written; 0 lifts the limit, and a generated file
+# copied through unchanged is held to none.
+if ! $update; then
+	mkdir -p "$work/maxsize"
+	{ printf 'package main\n\nfunc main() {}\n'; yes '// padding' | head -n 150000; } > "$work/maxsize/big.go"
+	if "$work/goshield" -i "$work/maxsize/big.go" -o "$work/maxsize/out.go" -max-file-size 1 "$@" > "$work/maxsize.txt" 2>&1; then
+		echo "FAIL maxsize: goshield accepted a file over -max-file-size"
+		failed=1
+	elif ! grep -q 'over the 1 MB limit (raise it with -max-file-size' "$work/maxsize.txt"; then
+		echo "FAIL maxsize: the error does not name the limit"
+		tail -n 3 "$work/maxsize.txt"
+		failed=1
+	elif [ -e "$work/maxsize/out.go" ]; then
+		echo "FAIL maxsize: the refused run wrote output"
+		failed=1
+	elif ! "$work/goshield" -i "$work/maxsize/big.go" -o "$work/maxsize/out.go" -max-file-size 0 "$@" > "$work/maxsize.txt" 2>&1; then
+		echo "FAIL maxsize: -max-file-size 0 did not lift the limit"
+		tail -n 3 "$work/maxsize.txt"
+		failed=1
+	elif mkdir -p "$work/maxsize/gen" &&
+		{ printf '// Code generated by hand. DO NOT EDIT.\n\npackage main\n\nconst generated = 1\n'; yes '// padding' | head -n 150000; } > "$work/maxsize/gen/gen.go" &&
+		printf 'package main\n\nfunc main() { println(generated) }\n' > "$work/maxsize/gen/main.go" &&
+		! "$work/goshield" -dir "$work/maxsize/gen" -o "$work/maxsize/genout" -max-file-size 1 "$@" > "$work/maxsize.txt" 2>&1; then
+		echo "FAIL maxsize: a generated file copied through was held to -max-file-size"
+		tail -n 3 "$work/maxsize.txt"
+		failed=1
+	elif ! cmp -s "$work/maxsize/gen/gen.go" "$work/maxsize/genout/gen.go"; then
+		echo "FAIL maxsize: the oversized generated file was not copied through"
+		failed=1
+	else
+		echo "ok   maxsize"
+	fi
+fi
+
+# An iota block becomes vars with the values the type checker computed.
+if ! $update; then
+	mkdir -p "$work/iota"
+	if ! "$work/goshield" -i "$cases/iota.go" -o "$work/iota/main.go" -seed iota -no-vars -no-ints -no-strings "$@" > "$work/iota.txt" 2>&1; then
+		echo "FAIL iota: goshield failed"
+		tail -n 5 "$work/iota.txt"
+		failed=1
+	elif ! grep -A3 '^var ($' "$work/iota/main.go" | tr -d '\t\n' | grep -q 'var (A = 0B = 1C = 2'; then
+		echo "FAIL iota: const ( A = iota; B; C ) did not become vars 0, 1, 2"
+		failed=1
+	elif [ "$(run "$work/iota" main.go)" != "$(cat "$cases/iota.golden")" ]; then
+		echo "FAIL iota: the program changed behavior"
+		failed=1
+	else
+		echo "ok   iota"
+	fi
+fi
+
+# Integers at the int64 limits keep their values under nested -poly
+# transforms, whatever the seed.
+if ! $update; then
+	bad=""
+	for seed in 1 2 3 4 5 6 7 8; do
+		mkdir -p "$work/bigints-$seed"
+		if ! "$work/goshield" -i "$cases/bigints.go" -o "$work/bigints-$seed/main.go" -seed "$seed" -poly -int-max 9223372036854775807 "$@" > /dev/null 2>&1 ||
+			[ "$(run "$work/bigints-$seed" main.go)" != "$(cat "$cases/bigints.golden")" ]; then
+			bad="$bad $seed"
+		fi
+	done
+	if [ -n "$bad" ]; then
+		echo "FAIL bigints: -poly changed integers at the int64 limits with seeds$bad"
+		failed=1
+	else
+		echo "ok   bigints poly"
+	fi
+fi
+
+# A second run copies goshield's own output through unchanged, with a
+# warning, and -force obfuscates it again without changing what it does. The
+# marker comment only counts as the last line: a file mentioning it elsewhere
+# is obfuscated like any other.
+if ! $update; then
+	mkdir -p "$work/rerun/first" "$work/rerun/second" "$work/rerun/forced" "$work/rerun/mention"
+	printf 'package main\n\n// goshield:obfuscated\nfunc main() { println("marked in the middle") }\n' > "$work/rerun/mention/in.go"
+	if ! "$work/goshield" -i "$cases/ints.go" -o "$work/rerun/first/main.go" -seed rerun "$@" > /dev/null 2>&1 ||
+		! "$work/goshield" -i "$work/rerun/first/main.go" -o "$work/rerun/second/main.go" -seed again "$@" > "$work/rerun.txt" 2>&1 ||
+		! "$work/goshield" -i "$work/rerun/first/main.go" -o "$work/rerun/forced/main.go" -seed again -force "$@" > /dev/null 2>&1; then
+		echo "FAIL rerun: goshield failed"
+		failed=1
+	elif ! cmp -s "$work/rerun/first/main.go" "$work/rerun/second/main.go"; then
+		echo "FAIL rerun: a second run changed goshield's own output"
+		failed=1
+	elif ! grep -q 'already obfuscated' "$work/rerun.txt"; then
+		echo "FAIL rerun: no warning about the already obfuscated input"
+		failed=1
+	elif cmp -s "$work/rerun/first/main.go" "$work/rerun/forced/main.go"; then
+		echo "FAIL rerun: -force did not obfuscate the output again"
+		failed=1
+	elif [ "$(run "$work/rerun/forced" main.go)" != "$(cat "$cases/ints.golden")" ]; then
+		echo "FAIL rerun: the output obfuscated twice changed behavior"
+		failed=1
+	elif ! "$work/goshield" -i "$work/rerun/mention/in.go" -o "$work/rerun/mention/out.go" -seed rerun "$@" > "$work/rerun-mention.txt" 2>&1 ||
+		grep -q 'already obfuscated' "$work/rerun-mention.txt" || grep -q 'marked in the middle' "$work/rerun/mention/out.go"; then
+		echo "FAIL rerun: a file with the marker before its last line was not obfuscated"
+		failed=1
+	else
+		echo "ok   rerun"
+	fi
+fi
+
+# Array lengths stay literal, indexes and slice bounds are transformed.
+if ! $update; then
+	mkdir -p "$work/indexes"
+	out="$work/indexes/main.go"
+	if ! "$work/goshield" -i "$cases/indexes.go" -o "$out" -seed indexes -int-min 2 "$@" > "$work/indexes.txt" 2>&1; then
+		echo "FAIL indexes: goshield failed"
+		tail -n 5 "$work/indexes.txt"
+		failed=1
+	elif ! grep -q ' \[10\]int$' "$out" || ! grep -q ' \[12\]\[16\]byte$' "$out"; then
+		echo "FAIL indexes: an array length was transformed"
+		failed=1
+	elif grep -vE '(int|byte)$' "$out" | grep -qE '\[[0-9]*[1-9][0-9]*[]:]|:[1-9][0-9]*\]'; then
+		echo "FAIL indexes: an index or slice bound was left as a plain literal"
+		grep -vE '(int|byte)$' "$out" | grep -E '\[[0-9]*[1-9][0-9]*[]:]|:[1-9][0-9]*\]'
+		failed=1
+	else
+		echo "ok   indexes literals"
+	fi
+fi
+
+# Byte and rune slice literals keep no readable element.
+if ! $update; then
+	mkdir -p "$work/bytes"
+	if ! "$work/goshield" -i "$cases/bytes.go" -o "$work/bytes/main.go" -seed bytes "$@" > "$work/bytes.txt" 2>&1; then
+		echo "FAIL bytes: goshield failed"
+		tail -n 5 "$work/bytes.txt"
+		failed=1
+	elif grep -nE "\{72, |'[^']+'" "$work/bytes/main.go"; then
+		echo "FAIL bytes: byte or rune slice elements left readable"
+		failed=1
+	else
+		echo "ok   bytes literals"
+	fi
+fi
+
+# -keep-exported-fields renames unexported fields only, without adding tags.
+if ! $update; then
+	mkdir -p "$work/keepfields"
+	out="$work/keepfields/main.go"
+	if ! "$work/goshield" -i "$cases/keepfields.go" -o "$out" -seed keepfields -fields -keep-exported-fields "$@" > "$work/keepfields.txt" 2>&1; then
+		echo "FAIL keepfields: goshield failed"
+		tail -n 5 "$work/keepfields.txt"
+		failed=1
+	elif grep -q 'json:"' "$out"; then
+		echo "FAIL keepfields: tags were added to kept fields"
+		failed=1
+	elif ! grep -qE '^\s+Owner\s+string$' "$out" || grep -qE '^\s+(secret|version)\s' "$out"; then
+		echo "FAIL keepfields: exported fields renamed or unexported ones kept"
+		failed=1
+	else
+		echo "ok   keepfields names"
+	fi
+fi
+
+# A pass set in Options.Passes by a program importing goshield
+# (testdata/passes) runs along with the built-in ones.
+if ! $update; then
+	mkdir -p "$work/passes"
+	printf 'package main\n\nfunc main() {\n\tgreeting := "hello"\n\tprintln(greeting)\n}\n' > "$work/passes/in.go"
+	if ! (cd "$root" && go build -o "$work/goshield-passes" ./testdata/passes) ||
+		! "$work/goshield-passes" "$work/passes/in.go" "$work/passes/main.go" > "$work/passes.txt" 2>&1; then
+		echo "FAIL passes: Obfuscate with a custom pass failed"
+		tail -n 5 "$work/passes.txt"
+		failed=1
+	elif ! grep -q 'renamedByPass' "$work/passes/main.go" || grep -q 'greeting' "$work/passes/main.go"; then
+		echo "FAIL passes: the custom pass did not run"
+		failed=1
+	elif [ "$(run "$work/passes" main.go)" != "$(printf 'hello\nexit: 0')" ]; then
+		echo "FAIL passes: the program changed behavior"
+		run "$work/passes" main.go | tail -n 3
+		failed=1
+	else
+		echo "ok   passes"
+	fi
+fi
+
+# The files in testdata/merge merge into one working file with a single
+# import block, unless two of them declare the same name.
+if ! $update; then
+	mkdir -p "$work/merge"
+	out="$work/merge/main.go"
+	if ! "$work/goshield" -i "$root/testdata/merge/a.go" -i "$root/testdata/merge/b.go" -o "$out" -seed merge "$@" > "$work/merge.txt" 2>&1; then
+		echo "FAIL merge: goshield failed"
+		tail -n 5 "$work/merge.txt"
+		failed=1
+	elif [ "$(grep -c '^import' "$out")" != 1 ] || [ "$(run "$work/merge" main.go)" != "$(printf 'HELLO WORLD\nexit: 0')" ]; then
+		echo "FAIL merge: merged output has several import blocks or changed behavior"
+		run "$work/merge" main.go | tail -n 3
+		failed=1
+	elif "$work/goshield" -i "$root/testdata/merge/a.go" -i "$root/testdata/merge/clash.go" -o "$work/merge/clash.go" "$@" > "$work/merge-clash.txt" 2>&1 ||
+		! grep -q 'shout redeclared' "$work/merge-clash.txt" || [ -e "$work/merge/clash.go" ]; then
+		echo "FAIL merge: a name declared in two inputs was not refused"
+		tail -n 3 "$work/merge-clash.txt"
+		failed=1
+	else
+		echo "ok   merge"
+	fi
+fi
+
+# Comma-separated -i inputs land in the -o directory under their own names
+# and keep referencing each other's renamed declarations.
+if ! $update; then
+	out="$work/multi/out"
+	if ! "$work/goshield" -i "$root/testdata/merge/a.go,$root/testdata/merge/b.go" -o "$out" -seed multi "$@" > "$work/multi.txt" 2>&1; then
+		echo "FAIL multi: goshield failed"
+		tail -n 5 "$work/multi.txt"
+		failed=1
+	else
+		printf 'module multi\n\ngo 1.21\n' > "$out/go.mod"
+		if [ "$(cd "$out" && ls *.go | tr '\n' ' ')" != "a.go b.go " ]; then
+			echo "FAIL multi: outputs not named after the inputs"
+			failed=1
+		elif grep -qw 'greeting' "$out/a.go" "$out/b.go"; then
+			echo "FAIL multi: the cross-file function kept its name"
+			failed=1
+		elif [ "$(cd "$out" && go run . 2>&1)" != "HELLO WORLD" ]; then
+			echo "FAIL multi: output differs"
+			(cd "$out" && go run . 2>&1 | tail -n 3)
+			failed=1
+		else
+			echo "ok   multi"
+		fi
+	fi
+fi
+
+# A generated file is copied through byte for byte, while the file using it is
+# obfuscated; -force obfuscates it too, and a -map-in map from that run, which
+# renamed the generated names, is an error without -force.
+if ! $update; then
+	out="$work/generated/out"
+	if ! "$work/goshield" -dir "$root/testdata/generated" -o "$out" -seed generated "$@" > "$work/generated.txt" 2>&1; then
+		echo "FAIL generated: goshield failed"
+		tail -n 5 "$work/generated.txt"
+		failed=1
+	else
+		printf 'module generated\n\ngo 1.21\n' > "$out/go.mod"
+		if ! cmp -s "$root/testdata/generated/gen.go" "$out/gen.go"; then
+			echo "FAIL generated: the generated file was changed"
+			failed=1
+		elif cmp -s "$root/testdata/generated/main.go" "$out/main.go"; then
+			echo "FAIL generated: the hand-written file was not obfuscated"
+			failed=1
+		elif [ "$(cd "$out" && go run . 2>&1)" != "$(printf 'Debug\nInfo\nError\nLevel(7)')" ]; then
+			echo "FAIL generated: output differs"
+			(cd "$out" && go run . 2>&1 | tail -n 3)
+			failed=1
+		elif ! "$work/goshield" -dir "$root/testdata/generated" -o "$work/generated/forced" -seed generated -force \
+			-map-out "$work/generated/forced.json" "$@" > "$work/generated-force.txt" 2>&1 ||
+			cmp -s "$root/testdata/generated/gen.go" "$work/generated/forced/gen.go"; then
+			echo "FAIL generated: -force did not obfuscate the generated file"
+			failed=1
+		elif "$work/goshield" -dir "$root/testdata/generated" -o "$work/generated/conflict" -seed generated \
+			-map-in "$work/generated/forced.json" "$@" > "$work/generated-conflict.txt" 2>&1 ||
+			! grep -q 'gen.go:[0-9]*:[0-9]*: .* was renamed to .* by an earlier run; obfuscate generated files first' "$work/generated-conflict.txt" ||
+			[ -n "$(ls -A "$work/generated/conflict" 2>/dev/null)" ]; then
+			echo "FAIL generated: a -map-in renaming a generated name did not stop the run"
+			tail -n 3 "$work/generated-conflict.txt"
+			failed=1
+		else
+			echo "ok   generated"
+		fi
+	fi
+fi
+
+# Input that is all generated is copied through as it is, with nothing left
+# for -rename-package to rename or -tamper-check to guard.
+if ! $update; then
+	mkdir -p "$work/genonly"
+	if ! "$work/goshield" -i "$root/testdata/generated/gen.go" -o "$work/genonly/gen.go" -seed genonly -rename-package -tamper-check "$@" > "$work/genonly.txt" 2>&1; then
+		echo "FAIL genonly: goshield failed"
+		tail -n 5 "$work/genonly.txt"
+		failed=1
+	elif ! cmp -s "$root/testdata/generated/gen.go" "$work/genonly/gen.go"; then
+		echo "FAIL genonly: the generated file was changed"
+		failed=1
+	else
+		echo "ok   genonly"
+	fi
+fi
+
+# -rename-package gives every file of a library package the same new package
+# name, and never renames package main. With -include-tests the external test
+# package gets the new name with _test appended, and go test still passes; it
+# imports the package, so goshield runs inside the module to resolve it.
+if ! $update; then
+	out="$work/renamepkg/out"
+	if ! "$work/goshield" -dir "$root/testdata/renamepkg" -o "$out" -seed renamepkg -rename-package -keep-exported "$@" > "$work/renamepkg.txt" 2>&1; then
+		echo "FAIL renamepkg: goshield failed"
+		tail -n 5 "$work/renamepkg.txt"
+		failed=1
+	else
+		printf 'module renamepkg\n\ngo 1.21\n' > "$out/go.mod"
+		names=$(grep -h '^package ' "$out"/*.go | sort -u)
+		if [ "$(printf '%s\n' "$names" | wc -l)" != 1 ] || [ "$names" = "package shapes" ]; then
+			echo "FAIL renamepkg: package clauses not renamed alike: $names"
+			failed=1
+		elif ! (cd "$out" && go vet . > /dev/null 2>&1); then
+			echo "FAIL renamepkg: the renamed package doesn't build"
+			failed=1
+		elif ! "$work/goshield" -i "$cases/ints.go" -o "$work/renamepkg/main.go" -seed renamepkg -rename-package "$@" > "$work/renamepkg-main.txt" 2>&1 ||
+			! grep -q '^package main$' "$work/renamepkg/main.go"; then
+			echo "FAIL renamepkg: package main was renamed"
+			failed=1
+		elif mkdir -p "$work/renamepkg/tests" && cp "$root/testdata/renamepkg/"*.go "$work/renamepkg/tests/" &&
+			printf 'module example.com/shapes\n\ngo 1.21\n' > "$work/renamepkg/tests/go.mod" &&
+			! (cd "$work/renamepkg/tests" && "$work/goshield" -dir . -o ../testsout -seed renamepkg -rename-package -keep-exported -include-tests "$@") > "$work/renamepkg-tests.txt" 2>&1; then
+			echo "FAIL renamepkg: goshield failed on the package with its external test"
+			tail -n 5 "$work/renamepkg-tests.txt"
+			failed=1
+		elif ! grep -q '^package .*_test$' "$work/renamepkg/testsout/shapes_test.go" ||
+			grep -q '^package shapes_test$' "$work/renamepkg/testsout/shapes_test.go"; then
+			echo "FAIL renamepkg: the external test package was not renamed with the package"
+			failed=1
+		elif cp "$work/renamepkg/tests/go.mod" "$work/renamepkg/testsout/" &&
+			! (cd "$work/renamepkg/testsout" && go test . > ../tests.txt 2>&1); then
+			echo "FAIL renamepkg: go test fails on the renamed package"
+			tail -n 5 "$work/renamepkg/tests.txt"
+			failed=1
+		else
+			echo "ok   renamepkg"
+		fi
+	fi
+fi
+
+# Strings one shorter than -min-string-len or -min-backtick-len stay readable,
+# those at the limit and over it do not.
+if ! $update; then
+	out="$work/minlen/main.go"
+	if ! "$work/goshield" -i "$cases/minlen.go" -o "$out" -seed minlen -min-string-len 5 -min-backtick-len 25 "$@" > "$work/minlen-limits.txt" 2>&1; then
+		echo "FAIL minlen: goshield failed"
+		tail -n 5 "$work/minlen-limits.txt"
+		failed=1
+	elif ! grep -q '"abcd"' "$out" || ! grep -q 'xy = 1' "$out"; then
+		echo "FAIL minlen: strings under the limits were encoded"
+		failed=1
+	elif grep -qE '"abcdef?"|xyzw? = 1' "$out"; then
+		echo "FAIL minlen: strings at or over the limits were left readable"
+		failed=1
+	else
+		echo "ok   minlen limits"
+	fi
+fi
+
+# -only-funcs encodes the literals of the functions it lists and leaves the
+# others readable.
+if ! $update; then
+	out="$work/only/main.go"
+	if ! "$work/goshield" -i "$cases/only.go" -o "$out" -seed only -only-funcs secret "$@" > "$work/only-funcs.txt" 2>&1; then
+		echo "FAIL only: goshield failed"
+		tail -n 5 "$work/only-funcs.txt"
+		failed=1
+	elif ! grep -q '"visible string "' "$out" || ! grep -qw 5555 "$out"; then
+		echo "FAIL only: literals of an unlisted function were encoded"
+		failed=1
+	elif grep -qF '"%s:%d"' "$out" || grep -qw 4242 "$out"; then
+		echo "FAIL only: literals of a listed function were left readable"
+		failed=1
+	else
+		echo "ok   only literals"
+	fi
+fi
+
+# A syntax error is reported as file:line:col with the offending line, and
+# nothing is written.
+if ! $update; then
+	mkdir -p "$work/syntax"
+	printf 'package main\n\nfunc main() {\n\tx := (1 +\n}\n' > "$work/syntax/bad.go"
+	if "$work/goshield" -i "$work/syntax/bad.go" -o "$work/syntax/out.go" "$@" > "$work/syntax.txt" 2>&1; then
+		echo "FAIL syntax: a file that doesn't parse was accepted"
+		failed=1
+	elif ! grep -q "bad.go:5:1: expected operand" "$work/syntax.txt" || ! grep -qE '^ +5 \| }$' "$work/syntax.txt"; then
+		echo "FAIL syntax: the error doesn't point at bad.go:5"
+		tail -n 5 "$work/syntax.txt"
+		failed=1
+	elif [ -e "$work/syntax/out.go" ]; then
+		echo "FAIL syntax: output written for a file that doesn't parse"
+		failed=1
+	else
+		echo "ok   syntax error"
+	fi
+fi
+
+# A -config value takes effect, a command-line flag overrides it under either
+# alias, and an option set twice through aliases is refused.
+if ! $update; then
+	mkdir -p "$work/config"
+	printf 'min-string-len: 100\nbacktick-min-len: 100\n' > "$work/config/limits.yaml"
+	printf '{"min-backtick-len": 30, "backtick-min-len": 40}\n' > "$work/config/dup.json"
+	if ! "$work/goshield" -i "$cases/minlen.go" -o "$work/config/file.go" -config "$work/config/limits.yaml" -seed config "$@" > "$work/config.txt" 2>&1 ||
+		! "$work/goshield" -i "$cases/minlen.go" -o "$work/config/flags.go" -config "$work/config/limits.yaml" -min-string-len 5 -min-backtick-len 25 -seed config "$@" >> "$work/config.txt" 2>&1; then
+		echo "FAIL config: goshield failed"
+		tail -n 5 "$work/config.txt"
+		failed=1
+	elif ! grep -q '"abcdef"' "$work/config/file.go" || ! grep -q 'xyzw = 1' "$work/config/file.go"; then
+		echo "FAIL config: the config file limits were not applied"
+		failed=1
+	elif grep -qE '"abcdef"|xyzw = 1' "$work/config/flags.go"; then
+		echo "FAIL config: command-line flags did not override the config file"
+		failed=1
+	elif "$work/goshield" -i "$cases/minlen.go" -o "$work/config/dup.go" -config "$work/config/dup.json" "$@" > "$work/config-dup.txt" 2>&1 ||
+		! grep -q 'set the same option' "$work/config-dup.txt"; then
+		echo "FAIL config: an option set under two aliases was accepted"
+		failed=1
+	else
+		echo "ok   config"
+	fi
+fi
+
+# -keep-header keeps a license header above the package clause; without it
+# the header goes with the other comments.
+if ! $update; then
+	mkdir -p "$work/header"
+	printf '// Copyright 2024 Acme Corp.\n// Licensed under the MIT License.\n\npackage main\n\nfunc main() { println("header") }\n' > "$work/header/in.go"
+	if ! "$work/goshield" -i "$work/header/in.go" -o "$work/header/kept.go" -keep-header "$@" > "$work/header.txt" 2>&1 ||
+		! "$work/goshield" -i "$work/header/in.go" -o "$work/header/stripped.go" "$@" >> "$work/header.txt" 2>&1; then
+		echo "FAIL header: goshield failed"
+		tail -n 5 "$work/header.txt"
+		failed=1
+	elif [ "$(head -n 2 "$work/header/kept.go")" != "$(head -n 2 "$work/header/in.go")" ]; then
+		echo "FAIL header: -keep-header dropped the license header"
+		head -n 3 "$work/header/kept.go"
+		failed=1
+	elif grep -q 'Copyright' "$work/header/stripped.go"; then
+		echo "FAIL header: the header was kept without -keep-header"
+		failed=1
+	else
+		echo "ok   header"
+	fi
+fi
+
+# -only-exported renames exported declarations only, -only-unexported the
+# others only.
+if ! $update; then
+	mkdir -p "$work/exports"
+	if ! "$work/goshield" -i "$cases/exports.go" -o "$work/exports/exported.go" -only-exported -seed exports "$@" > "$work/exports.txt" 2>&1 ||
+		! "$work/goshield" -i "$cases/exports.go" -o "$work/exports/unexported.go" -only-unexported -seed exports "$@" >> "$work/exports.txt" 2>&1; then
+		echo "FAIL exports: goshield failed"
+		tail -n 5 "$work/exports.txt"
+		failed=1
+	elif grep -qE 'Public(Widget|Limit|Greeting)' "$work/exports/exported.go" ||
+		[ "$(grep -coE 'private(Widget|Limit|Greeting)' "$work/exports/exported.go")" = 0 ]; then
+		echo "FAIL exports: -only-exported renamed the wrong names"
+		failed=1
+	elif grep -qE 'private(Widget|Limit|Greeting)' "$work/exports/unexported.go" ||
+		[ "$(grep -coE 'Public(Widget|Limit|Greeting)' "$work/exports/unexported.go")" = 0 ]; then
+		echo "FAIL exports: -only-unexported renamed the wrong names"
+		failed=1
+	elif [ "$(grep -oE '(Public|private)(Widget|Limit|Greeting)' "$work/exports/exported.go" | sort -u | wc -l)" != 3 ] ||
+		[ "$(grep -oE '(Public|private)(Widget|Limit|Greeting)' "$work/exports/unexported.go" | sort -u | wc -l)" != 3 ]; then
+		echo "FAIL exports: a name of the kept kind was renamed"
+		failed=1
+	else
+		echo "ok   exports names"
+	fi
+fi
+
+# -obfuscate-urls encodes strings holding :// that are left readable by
+# default; -keep-strings keeps what it matches either way.
+if ! $update; then
+	mkdir -p "$work/urls"
+	if ! "$work/goshield" -i "$cases/urls.go" -o "$work/urls/on.go" -obfuscate-urls -keep-strings ^keep -seed urls "$@" > "$work/urls.txt" 2>&1 ||
+		! "$work/goshield" -i "$cases/urls.go" -o "$work/urls/off.go" -keep-strings ^keep -seed urls "$@" >> "$work/urls.txt" 2>&1; then
+		echo "FAIL urls: goshield failed"
+		tail -n 5 "$work/urls.txt"
+		failed=1
+	elif grep -q 'example\.com' "$work/urls/on.go"; then
+		echo "FAIL urls: -obfuscate-urls left a URL readable"
+		failed=1
+	elif ! grep -q '"https://api.example.com/v1/"' "$work/urls/off.go" || ! grep -q '"ftp://files.example.com"' "$work/urls/off.go"; then
+		echo "FAIL urls: a URL was encoded without -obfuscate-urls"
+		failed=1
+	elif ! grep -q '"keep me readable"' "$work/urls/on.go" || grep -q 'obfuscate me' "$work/urls/on.go"; then
+		echo "FAIL urls: -keep-strings kept the wrong strings"
+		failed=1
+	else
+		echo "ok   urls encoding"
+	fi
+fi
+
+# Integers on a line that also holds strings are transformed like any other.
+if ! $update; then
+	mkdir -p "$work/mixed"
+	if ! "$work/goshield" -i "$cases/mixed.go" -o "$work/mixed/main.go" -seed mixed "$@" > "$work/mixed.txt" 2>&1; then
+		echo "FAIL mixed: goshield failed"
+		tail -n 5 "$work/mixed.txt"
+		failed=1
+	elif grep -qwE '4242|9000|5678|31337' "$work/mixed/main.go"; then
+		echo "FAIL mixed: an integer next to a string was left as written"
+		grep -nwE '4242|9000|5678|31337' "$work/mixed/main.go" | head -n 3
+		failed=1
+	elif grep -qE 'order|room|count' "$work/mixed/main.go"; then
+		echo "FAIL mixed: a string next to an integer was left readable"
+		failed=1
+	else
+		echo "ok   mixed literals"
+	fi
+fi
+
+# A panic's stack trace from an obfuscated program, piped through -deobf with
+# the run's -map-out, names the original functions again.
+if ! $update; then
+	mkdir -p "$work/deobf"
+	printf 'module deobf\n\ngo 1.21\n' > "$work/deobf/go.mod"
+	printf 'package main\n\nfunc explodeWidget(n int) int {\n\tif n > 2 {\n\t\tpanic("boom")\n\t}\n\treturn n\n}\n\nfunc assembleWidget(n int) int { return explodeWidget(n + 1) }\n\nfunc main() { println(assembleWidget(len("abc"))) }\n' > "$work/deobf/in.go"
+	if ! "$work/goshield" -i "$work/deobf/in.go" -o "$work/deobf/main.go" -seed deobf -map-out "$work/deobf/map.json" "$@" > "$work/deobf.txt" 2>&1; then
+		echo "FAIL deobf: goshield failed"
+		tail -n 5 "$work/deobf.txt"
+		failed=1
+	elif rm "$work/deobf/in.go" && run "$work/deobf" main.go > "$work/deobf/trace.txt"; ! grep -q 'panic: boom' "$work/deobf/trace.txt"; then
+		echo "FAIL deobf: the obfuscated program did not panic"
+		tail -n 5 "$work/deobf/trace.txt"
+		failed=1
+	elif grep -qE 'explodeWidget|assembleWidget' "$work/deobf/trace.txt"; then
+		echo "FAIL deobf: the trace shows original names before -deobf"
+		failed=1
+	elif ! "$work/goshield" -deobf -map-in "$work/deobf/map.json" < "$work/deobf/trace.txt" > "$work/deobf/restored.txt" 2>&1; then
+		echo "FAIL deobf: goshield -deobf failed"
+		tail -n 5 "$work/deobf/restored.txt"
+		failed=1
+	elif ! grep -q 'main\.explodeWidget(' "$work/deobf/restored.txt" || ! grep -q 'main\.assembleWidget(' "$work/deobf/restored.txt"; then
+		echo "FAIL deobf: the original names did not come back"
+		head -n 12 "$work/deobf/restored.txt"
+		failed=1
+	else
+		echo "ok   deobf trace"
+	fi
+fi
+
+# -dry-run writes nothing, neither the -dir output directory nor -map-out, and
+# its -json summary is one valid JSON object.
+if ! $update; then
+	mkdir -p "$work/dryrun/in"
+	printf 'package main\n\nfunc greet() string { return "hello there" }\n' > "$work/dryrun/in/greet.go"
+	printf 'package main\n\nfunc main() { println(greet()) }\n' > "$work/dryrun/in/main.go"
+	if ! "$work/goshield" -dir "$work/dryrun/in" -o "$work/dryrun/out" -map-out "$work/dryrun/map.json" -dry-run -json "$@" > "$work/dryrun/summary.json" 2> "$work/dryrun.txt"; then
+		echo "FAIL dryrun: goshield failed"
+		tail -n 5 "$work/dryrun.txt"
+		failed=1
+	elif [ -e "$work/dryrun/out" ] || [ -e "$work/dryrun/map.json" ]; then
+		echo "FAIL dryrun: -dry-run wrote" $(ls "$work/dryrun")
+		failed=1
+	elif ! renamed=$(jsonnum renamed < "$work/dryrun/summary.json"); then
+		echo "FAIL dryrun: the -json summary is not valid JSON"
+		head -n 5 "$work/dryrun/summary.json"
+		failed=1
+	elif [ "$renamed" = 0 ]; then
+		echo "FAIL dryrun: the summary counts no renamed identifiers"
+		failed=1
+	else
+		echo "ok   dryrun"
+	fi
+fi
+
+# -report writes the run's counts to a JSON file after a normal run.
+if ! $update; then
+	mkdir -p "$work/report"
+	if ! "$work/goshield" -i "$cases/ints.go" -o "$work/report/main.go" -seed report -report "$work/report/report.json" "$@" > "$work/report.txt" 2>&1; then
+		echo "FAIL report: goshield failed"
+		tail -n 5 "$work/report.txt"
+		failed=1
+	elif ! renamed=$(jsonnum renamed < "$work/report/report.json"); then
+		echo "FAIL report: the report is not valid JSON"
+		head -n 5 "$work/report/report.json"
+		failed=1
+	elif [ "$renamed" = 0 ]; then
+		echo "FAIL report: the report counts no renamed identifiers"
+		failed=1
+	else
+		echo "ok   report"
+	fi
+fi
+
+# A package function named like a builtin is renamed like any other, and so
+# are locals named like one, while calls to the builtins stay.
+if ! $update && [ -f "$work/shadowbuiltins/main.go" ]; then
+	if grep -qE 'func min\(|max :=|clear :=' "$work/shadowbuiltins/main.go"; then
+		echo "FAIL shadowbuiltins: a declaration named like a builtin kept its name"
+		failed=1
+	elif ! grep -q 'max(4, 7)' "$work/shadowbuiltins/main.go" || ! grep -qE '\bclear\(' "$work/shadowbuiltins/main.go"; then
+		echo "FAIL shadowbuiltins: a builtin call was renamed"
+		failed=1
+	else
+		echo "ok   shadowbuiltins names"
+	fi
+fi
+
+exit $failed
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type server struct {
+	Host  string
+	limit struct {
+		burst int
+		rate  float64
+	}
+}
+
+// Same fields as the anonymous struct, so conversions must keep matching
+type point struct{ x, y int }
+
+func origin() struct{ x, y int } {
+	return struct{ x, y int }{x: 0, y: 0}
+}
+
+func main() {
+	var cfg = struct {
+		Name  string
+		Port  int
+		debug bool
+	}{Name: "api", Port: 8080}
+	cfg.debug = true
+	fmt.Println(cfg.Name, cfg.Port, cfg.debug)
+
+	rows := []struct {
+		key   string
+		count int
+	}{{key: "a", count: 1}, {"b", 2}}
+	for _, r := range rows {
+		fmt.Println(r.key, r.count)
+	}
+
+	byName := map[string]struct{ min, max int }{
+		"small": {min: 1, max: 9},
+		"large": {min: 10, max: 99},
+	}
+	fmt.Println(byName["small"].min, byName["large"].max)
+
+	var s server
+	s.Host = "localhost"
+	s.limit.burst = 5
+	s.limit.rate = 1.5
+	fmt.Println(s.Host, s.limit.burst, s.limit.rate)
+
+	p := point(origin())
+	p.x++
+	fmt.Println(p.x, p.y)
+
+	nested := struct {
+		inner struct{ depth int }
+		tags  []string
+	}{inner: struct{ depth int }{depth: 3}, tags: []string{"x"}}
+	fmt.Println(nested.inner.depth, nested.tags)
+
+	// Encoders see the original names through the added tags
+	out, _ := json.Marshal(struct {
+		Label string
+		Value int
+	}{Label: "v", Value: 7})
+	fmt.Println(string(out))
+}
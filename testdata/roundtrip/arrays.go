@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+var table [256]byte
+
+func main() {
+	var grid [10][64]int
+	buf := make([]int, 4096, 8192)
+	buf[1000] = 77
+	grid[9][63] = 12345
+	table[200] = 42
+	window := buf[1000:2048]
+	literal := [...]string{3: "three", 99: "last"}
+	fmt.Println(len(grid), len(grid[0]), len(buf), cap(buf), buf[1000], grid[9][63], table[200], len(window), len(literal))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+const greeting = "hello, base64"
+
+var query = `SELECT id, name FROM users WHERE name = ?`
+
+var labels = map[string]string{"en": "Welcome home", "pt": "Bem-vindo de volta"}
+
+func main() {
+	fmt.Println(greeting)
+	fmt.Printf("%s has %d entries\n", "labels", len(labels))
+	fmt.Println(labels["en"], labels["pt"], strings.ToUpper("unicode: ção ✓"))
+	fmt.Println(query)
+	tpl := template.Must(template.New("t").Parse("Hi {{.}}!\n"))
+	if err := tpl.Execute(os.Stdout, "gopher"); err != nil {
+		fmt.Println("template failed:", err)
+	}
+}
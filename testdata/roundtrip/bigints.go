@@ -0,0 +1,36 @@
+package main
+
+import "fmt"
+
+// Literals at the int64 limit and around the multiplier bounds: a transform
+// computed with wrapping int64 arithmetic would print another value
+var limits = []int64{
+	9223372036854775807,
+	9223372036854775806,
+	9223372036854775805,
+	9223372036854775804,
+	9223372036854775803,
+	9223372036854775802,
+	9223372036854775801,
+	9223372036854775800,
+	9223372036854775799,
+	9223372036854775798,
+	9223372036854775797,
+	9223372036854775796,
+	4611686018427387903, 4611686018427387904,
+	3074457345618258602, 3074457345618258603,
+	1844674407370955161, 1844674407370955162,
+	1317624576693539401, 1317624576693539402,
+	838488366986797800, 838488366986797801,
+	-9223372036854775807 - 1,
+	-(9223372036854775807 - 999),
+}
+
+func main() {
+	for _, n := range limits {
+		fmt.Println(n)
+	}
+	// Beyond int64, left alone
+	var max uint64 = 18446744073709551615
+	fmt.Println(max, uint64(9223372036854775808))
+}
@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// largest shadows the max builtin with a local variable
+func largest(values []int) int {
+	max := values[0]
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+func main() {
+	a, b := 3, 7
+	fmt.Println(min(a, b), max(a, b, 5), min(2.5, 1.5))
+	fmt.Println(clamp(12, 0, 10), clamp(-4, 0, 10))
+
+	counts := map[string]int{"x": 1, "y": 2}
+	clear(counts)
+	values := []int{1, 2, 3}
+	clear(values)
+	fmt.Println(len(counts), values)
+
+	fmt.Println(largest([]int{4, 9, 2}))
+	min := "shadowed"
+	fmt.Println(min)
+}
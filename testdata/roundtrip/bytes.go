@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type magic [4]byte
+
+var header = magic{0x7f, 'E', 'L', 'F'}
+
+func main() {
+	hello := []byte{72, 101, 108, 108, 111}
+	fmt.Println(string(hello), hello)
+
+	chars := []byte{'h', 'i', '\n', '\x00', '\''}
+	fmt.Printf("%q %v\n", chars, chars)
+
+	runes := []rune{'é', 'ß', 'x', 0, 1}
+	fmt.Println(string(runes[:3]), runes)
+
+	fmt.Println(header, header == magic{127, 69, 76, 70})
+
+	sparse := [8]byte{0: 1, 7: 2}
+	nested := [][]byte{{1, 2}, {3}}
+	fmt.Println(sparse, nested, bytes.Equal(nested[0], []byte{1, 2}))
+
+	// Not bytes: small ints stay below -int-min
+	small := []int{1, 2, 3}
+	fmt.Println(small)
+}
@@ -0,0 +1,32 @@
+package main
+
+/*
+#include <stdlib.h>
+
+static int add(int a, int b) { return a + b; }
+
+static const char *greeting(void) { return "hello from C"; }
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func sum(values []int) int {
+	total := C.int(0)
+	for _, v := range values {
+		total = C.add(total, C.int(v))
+	}
+	return int(total)
+}
+
+func main() {
+	fmt.Println(sum([]int{1, 2, 3, 4}))
+	fmt.Println(C.GoString(C.greeting()))
+
+	msg := C.CString("copied into C memory")
+	defer C.free(unsafe.Pointer(msg))
+	fmt.Println(C.GoString(msg))
+}
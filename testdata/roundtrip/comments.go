@@ -0,0 +1,33 @@
+//go:build !nothing
+
+// Package main shows doc comments surviving with -keep-comments.
+package main
+
+import "fmt"
+
+// greeting is printed first. It says "hello" and mentions a lone ` backtick.
+const greeting = "hello, commented world"
+
+/*
+Server holds the address to "serve" on, see `address`.
+*/
+type Server struct {
+	address string // where to listen, e.g. "localhost:80"
+}
+
+// describe returns a `summary` of s.
+func (s Server) describe() string {
+	// the raw string below is code
+	return fmt.Sprintf("server at %s", s.address) + ` and done`
+}
+
+func main() {
+	fmt.Println(greeting) // trailing "quoted" comment
+	s := Server{address: "127.0.0.1:8080"}
+	fmt.Println(s.describe())
+	total := 0
+	for i := 0; i < 25; i++ { // count to 25
+		total += i
+	}
+	fmt.Println(total)
+}
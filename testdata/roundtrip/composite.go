@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+type option struct {
+	Name  string
+	Usage string
+}
+
+// Elements that merely mention flags or setters are still encoded
+var options = []option{{"FlagVerbose", "print more"}, {Name: "launcher.mode", Usage: "how to .Set(x) up"}}
+
+var codes = map[string]int{"alpha": 1001, "beta": 2002, "Flags": 3003}
+
+var grid = [][]int{{101, 202}, {303, 404}}
+
+var byIndex = [5]string{3: "three", 4: "four"}
+
+var nested = map[string][]string{
+	"colors": {"red", "green"},
+	"shapes": {"circle"},
+}
+
+func main() {
+	// A lookup table built and queried with the same literals
+	local := map[string]string{"key one": "value one", "key two": "value two"}
+	fmt.Println(local["key one"], local["key two"], len(local))
+	for _, name := range []string{"alpha", "beta", "Flags", "missing"} {
+		code, ok := codes[name]
+		fmt.Println(name, code, ok)
+	}
+	set := map[int]bool{4096: true, 8192: false}
+	fmt.Println(set[4096], set[8192], []int{12, 34, 56}[1])
+	fmt.Println(options, grid, byIndex, nested["colors"], nested["shapes"])
+}
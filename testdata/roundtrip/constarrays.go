@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+// Needed as constants: array lengths and other constants' values
+const blockSize = 16
+
+const (
+	headerSize = 4
+	frameSize  = headerSize + blockSize
+	greeting   = "hello, constant"
+)
+
+// Nothing requires these to be constants, so they may become vars
+const (
+	retries = 3
+	label   = "retry label"
+)
+
+type level int
+
+const (
+	low level = iota
+	medium
+	high
+)
+
+var frame [frameSize]byte
+
+func main() {
+	var block [blockSize]byte
+	var header [headerSize]int
+	var text [len(greeting)]byte
+	copy(text[:], greeting)
+	fmt.Println(len(block), len(header), len(frame), string(text[:5]))
+	fmt.Println(retries, label, low, medium, high)
+	fmt.Println(high > low)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Package-level const durations must stay const
+const timeout = 5 * time.Second
+
+const backoff time.Duration = 250 * time.Millisecond
+
+var interval = 3 * time.Minute
+
+func main() {
+	const grace = time.Hour * 2
+	wait := 4 * time.Second
+	var poll = time.Duration(7) * time.Millisecond
+	fmt.Println(timeout, backoff, interval, grace, wait, poll)
+	fmt.Println(timeout+wait, time.Duration(1500)*time.Microsecond, os.FileMode(0644))
+
+	// A const count in a non-const expression keeps its name
+	const retries = 3
+	fmt.Println(retries * time.Second)
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+type Base struct {
+	ID   int
+	Kind string
+}
+
+type Outer struct {
+	Base
+	Label string
+}
+
+func main() {
+	o := Outer{Base: Base{ID: 7, Kind: "k"}, Label: "lbl"}
+	fmt.Println(o.Base.ID, o.ID, o.Kind, o.Label)
+}
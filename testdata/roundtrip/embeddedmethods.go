@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type shape interface {
+	Area() float64
+	name() string
+}
+
+type square struct{ side float64 }
+
+func (s square) Area() float64 { return s.side * s.side }
+func (s square) name() string  { return "square" }
+
+// Embeds interfaces whose methods share names with fields of other structs:
+// l.Area() and l.name() call methods and must keep their names
+type labeled struct {
+	shape
+	io.Reader
+	label string
+}
+
+type record struct {
+	Area  int
+	name  string
+	Read  bool
+	Close func() error
+}
+
+// A field shadowing a promoted method keeps the method out of the method set
+type shadow struct {
+	io.Reader
+	Read int
+}
+
+type fetcher interface{ fetch() string }
+
+type remote struct{ url string }
+
+func (r remote) fetch() string { return "GET " + r.url }
+
+type cached struct {
+	fetcher
+	fetch string
+}
+
+func main() {
+	l := labeled{shape: square{2}, Reader: strings.NewReader("abc"), label: "l"}
+	buf := make([]byte, 3)
+	n, _ := l.Read(buf)
+	fmt.Println(l.Area(), l.name(), l.label, n, string(buf))
+	r := record{Area: 4, name: "r", Read: true, Close: func() error { return nil }}
+	fmt.Println(r.Area, r.name, r.Read, r.Close() == nil)
+	var x interface{} = shadow{Read: 1}
+	_, isReader := x.(io.Reader)
+	fmt.Println(isReader, x.(shadow).Read)
+	var y interface{} = cached{fetcher: remote{"u"}, fetch: "hit"}
+	_, isFetcher := y.(fetcher)
+	c := y.(cached)
+	fmt.Println(isFetcher, c.fetch, c.fetcher.fetch())
+}
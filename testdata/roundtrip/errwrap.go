@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+var errMissing = errors.New("config file missing")
+
+func load(name string) error {
+	return fmt.Errorf("load %s: %w", name, errMissing)
+}
+
+func open(name string) error {
+	return fmt.Errorf("open %[2]s failed (%[1]w), giving up", fs.ErrNotExist, name)
+}
+
+func main() {
+	err := fmt.Errorf("wrap: %w", load("app.yaml"))
+	fmt.Println(err)
+	fmt.Println(errors.Is(err, errMissing), errors.Unwrap(errors.Unwrap(err)) == errMissing)
+
+	err = open("data.db")
+	fmt.Println(err)
+	fmt.Println(errors.Is(err, fs.ErrNotExist))
+	fmt.Printf("%5.1f%% done, %*d left\n", 99.5, 4, 7)
+}
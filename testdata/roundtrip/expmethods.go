@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type Counter struct {
+	total int
+}
+
+func (c *Counter) Add(n int) {
+	c.total += c.scale(n)
+}
+
+func (c *Counter) Total() int {
+	return c.total
+}
+
+func (c *Counter) scale(n int) int {
+	return n * 10
+}
+
+func (c *Counter) reset() {
+	c.total = 0
+}
+
+func main() {
+	c := &Counter{}
+	c.Add(4)
+	c.Add(2)
+	fmt.Println(c.Total())
+	c.reset()
+	fmt.Println(c.Total())
+	// Reflection lists only the exported methods, by their current names
+	t := reflect.TypeOf(c)
+	for i := 0; i < t.NumMethod(); i++ {
+		fmt.Println(t.Method(i).Name)
+	}
+}
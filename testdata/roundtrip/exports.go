@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+// Each exported declaration has an unexported twin: -only-exported renames
+// the first kind only, -only-unexported the second
+type PublicWidget struct{ size int }
+
+type privateWidget struct{ size int }
+
+var PublicLimit = 3
+
+var privateLimit = 4
+
+func PublicGreeting() string { return "hello" }
+
+func privateGreeting() string { return "psst" }
+
+func main() {
+	fmt.Println(PublicWidget{size: PublicLimit}, privateWidget{size: privateLimit})
+	fmt.Println(PublicGreeting(), privateGreeting())
+}
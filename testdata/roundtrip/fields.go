@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Config struct {
+	Timeout int
+	Name    string
+	Tags    map[string]int
+}
+
+type Pair struct{ Key, Value string }
+
+type Point struct {
+	X     int
+	Label string
+}
+
+type Registry map[string]Config
+
+const Timeout = "tkey"
+
+func main() {
+	c := Config{Timeout: 5, Name: "svc", Tags: map[string]int{"alpha": 1, Timeout: 2}}
+	list := []Config{{Timeout: 1}, {Name: "second"}}
+	ptrs := []*Pair{{Key: "k", Value: "v"}}
+	reg := Registry{"one": {Timeout: 9}}
+	nested := map[Pair]Config{{Key: "a"}: {Name: "n"}}
+	client := http.Client{Timeout: 3 * time.Second}
+	fmt.Println(c.Timeout, c.Name, c.Tags["tkey"], list[0].Timeout, list[1].Name, ptrs[0].Key, ptrs[0].Value, reg["one"].Timeout, nested[Pair{Key: "a"}].Name, client.Transport == nil)
+
+	// unkeyed literals are positional and survive the renamed fields
+	pt := Point{1, "x"}
+	pairs := []Pair{{"a", "b"}}
+	fmt.Println(pt.X, pt.Label, pairs[0].Key, pairs[0].Value)
+}
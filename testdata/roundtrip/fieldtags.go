@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type Server struct {
+	Host    string
+	Port    int    `json:",omitempty"`
+	Owner   string `db:"owner_id" validate:"required"`
+	Timeout int    `mapstructure:"timeout_ms"`
+	note    string
+}
+
+type Note struct {
+	XMLName xml.Name `xml:"note"`
+	Lang    string   `xml:"lang,attr"`
+	Body    string   `xml:",chardata"`
+}
+
+// decode fills the struct pointed to by out from values, matching keys the
+// way mapstructure does: the tag name, or else the field name ignoring case.
+func decode(values map[string]interface{}, out interface{}) {
+	v := reflect.ValueOf(out).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := field.Tag.Get("mapstructure")
+		if key == "" {
+			key = field.Name
+		}
+		for name, value := range values {
+			if strings.EqualFold(name, key) {
+				v.Field(i).Set(reflect.ValueOf(value))
+			}
+		}
+	}
+}
+
+func main() {
+	var server Server
+	decode(map[string]interface{}{"host": "example.org", "PORT": 8080, "owner": "ops", "timeout_ms": 250}, &server)
+	server.note = "primary"
+	data, _ := json.Marshal(server)
+	fmt.Println(string(data), server.note)
+
+	field, _ := reflect.TypeOf(server).FieldByIndex([]int{2}), 0
+	fmt.Println(field.Tag.Get("db"), field.Tag.Get("validate"))
+
+	var back Server
+	json.Unmarshal(data, &back)
+	fmt.Println(back.Host, back.Port, back.Owner, back.Timeout)
+
+	out, _ := xml.Marshal(Note{Lang: "en", Body: "remember the milk"})
+	fmt.Println(string(out))
+}
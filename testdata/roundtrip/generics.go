@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+type Number interface {
+	~int | ~float64
+}
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+func Sum[T Number](values ...T) T {
+	var total T
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+func (p Pair[K, V]) String() string {
+	return fmt.Sprintf("%v=%v", p.Key, p.Value)
+}
+
+func mapSlice[T, U any](items []T, convert func(T) U) []U {
+	result := make([]U, 0, len(items))
+	for _, item := range items {
+		result = append(result, convert(item))
+	}
+	return result
+}
+
+func main() {
+	pair := Pair[string, int]{Key: "answer", Value: 42}
+	fmt.Println(pair, Sum(1, 2, 3, 400), Sum(1.5, 2.25))
+	fmt.Println(mapSlice([]int{10, 20, 300}, func(n int) string { return fmt.Sprint(n * 2) }))
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"embed"
+	_ "embed"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// static holds the assets under static/.
+//
+//go:embed static/*
+var static embed.FS
+
+//go:embed version.txt
+var version string
+
+var (
+	// banner is embedded as bytes.
+	//go:embed static/hello.txt
+	banner []byte
+)
+
+func main() {
+	names, err := fs.Glob(static, "static/*")
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range names {
+		data, _ := static.ReadFile(name)
+		fmt.Printf("%s: %s", name, data)
+	}
+	fmt.Println("version", version, strings.TrimSpace(string(banner)))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// byteSource implements io.Reader and io.ByteReader
+type byteSource struct {
+	data string
+	pos  int
+}
+
+func (b *byteSource) Read(p []byte) (int, error) {
+	if b.pos >= len(b.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data[b.pos:])
+	b.pos += n
+	return n, nil
+}
+
+func (b *byteSource) ReadByte() (byte, error) {
+	if b.pos >= len(b.data) {
+		return 0, io.EOF
+	}
+	b.pos++
+	return b.data[b.pos-1], nil
+}
+
+type byLength []string
+
+func (s byLength) Len() int           { return len(s) }
+func (s byLength) Less(i, j int) bool { return len(s[i]) < len(s[j]) }
+func (s byLength) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type shape interface {
+	Area() int
+	Describe() string
+}
+
+type square struct{ side int }
+
+func (q square) Area() int        { return q.side * q.side }
+func (q square) Describe() string { return fmt.Sprintf("square of %d", q.side) }
+func (q square) Scale(n int) square { return square{q.side * n} }
+
+func total(items []shape) int {
+	sum := 0
+	for _, item := range items {
+		sum += item.Area()
+	}
+	return sum
+}
+
+func drain(r interface{ ReadByte() (byte, error) }) string {
+	var sb strings.Builder
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return sb.String()
+		}
+		sb.WriteByte(c)
+	}
+}
+
+func main() {
+	scanner := bufio.NewScanner(&byteSource{data: "first line\nsecond line\n"})
+	for scanner.Scan() {
+		fmt.Println("line:", scanner.Text())
+	}
+	fmt.Println(drain(&byteSource{data: "bytes"}))
+	var br io.ByteReader = &byteSource{data: "x"}
+	c, _ := br.ReadByte()
+	fmt.Println(string(c))
+
+	words := byLength{"banana", "fig", "apple"}
+	sort.Sort(words)
+	fmt.Println(words)
+
+	shapes := []shape{square{2}, square{3}.Scale(2)}
+	fmt.Println(total(shapes), shapes[1].Describe())
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	_ "image/png"
+	str "strings"
+	. "math"
+)
+
+const greeting = "hello from a constant"
+
+const (
+	small = 7
+	large = 4096
+)
+
+var sizes = make([]int, large/1024)
+
+func main() {
+	sizes[1] = small
+	fmt.Println(str.ToUpper(greeting), len(sizes), sizes[1], Sqrt(float64(large)))
+}
@@ -0,0 +1,31 @@
+package main
+
+import "fmt"
+
+// Array lengths are part of the type and stay readable constants; indexes,
+// slice bounds and make sizes are values and get transformed
+type grid [12][16]byte
+
+func main() {
+	var a [10]int
+	for i := range a {
+		a[i] = i * i
+	}
+	fmt.Println(a[9], a[3:7], a[2:8:9])
+
+	s := make([]int, 20, 40)
+	s[15] = 7
+	fmt.Println(len(s[12:]), cap(s[:13]), s[15])
+
+	var g grid
+	g[11][15] = 1
+	fmt.Println(len(g), len(g[0]), g[11][15])
+
+	b := [...]string{12: "x"}
+	fmt.Println(len(b), b[12])
+
+	const n = 14
+	var c [n + 1]int
+	c[n] = 5
+	fmt.Println(len(c), c[14])
+}
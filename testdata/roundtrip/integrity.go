@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const greeting = "hello from an unguarded constant"
+
+//goshield:integrity-begin
+const (
+	licenseKey = "ACME-5678-INTEGRITY"
+	endpoint   = "https://license.example.com/check"
+)
+
+//goshield:integrity-end
+
+const build = "build 17"
+
+// onTamper runs instead of the default exit when the check fails.
+func onTamper() {
+	fmt.Println("modified")
+	os.Exit(3)
+}
+
+func main() {
+	fmt.Println(greeting)
+	fmt.Println(licenseKey, endpoint, build)
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+const big = 0xDEAD_BEEF
+
+func main() {
+	a := 1_000_000
+	b, c, d := 0x1F, 0o17, 0b1010
+	var arr [0x10]int
+	e := 017
+	fmt.Println(a, b, c, d, len(arr), e, big, uint64(0xFFFFFFFFFFFFFFFF), fmt.Sprintf("%d items", 42))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	A = iota
+	B
+	C
+)
+
+type color int
+
+const (
+	red color = iota + 1
+	green
+	blue
+)
+
+func (c color) String() string {
+	switch c {
+	case red:
+		return "red"
+	case green:
+		return "green"
+	}
+	return fmt.Sprintf("color(%d)", int(c))
+}
+
+type perm uint8
+
+const (
+	read perm = 1 << iota
+	write
+	exec
+)
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+)
+
+const (
+	below = -1 - iota
+	further
+)
+
+const (
+	prefix = "id-"
+	other
+)
+
+// Kept const: a rune, array literal keys and an untyped constant multiplied
+// by a time.Duration
+const (
+	first = 'a' + iota
+	second
+)
+
+type level int
+
+const (
+	low level = iota
+	high
+)
+
+var levelNames = [...]string{low: "low", high: "high"}
+
+const (
+	fast = iota + 1
+	slow
+)
+
+func main() {
+	fmt.Println(A, B, C, time.Duration(C)*time.Second)
+	fmt.Println(red, green, blue)
+	fmt.Println(read|exec, write&^read)
+	fmt.Println(KB, MB)
+	fmt.Println(below, further)
+	fmt.Println(prefix + other)
+	fmt.Println(string(first), string(second))
+	fmt.Println(levelNames[low], levelNames[high])
+	fmt.Println(fast*time.Millisecond, slow*time.Millisecond)
+}
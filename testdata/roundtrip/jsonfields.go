@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// -fields renames the fields; the exported ones must stay exported or
+// encoding/json skips them.
+type Order struct {
+	ID       int      `json:"id"`
+	Customer string   `json:"customer"`
+	Items    []string `json:"items,omitempty"`
+	Total    float64  `json:"total"`
+	note     string
+}
+
+func main() {
+	order := Order{ID: 7, Customer: "ada", Items: []string{"tea", "cake"}, Total: 12.5, note: "fragile"}
+	data, err := json.Marshal(order)
+	fmt.Println(string(data), err, order.note)
+	var back Order
+	err = json.Unmarshal(data, &back)
+	fmt.Println(back.ID, back.Customer, len(back.Items), back.Total, err)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Untagged: encoders and reflection see the Go field names
+type account struct {
+	ID      int
+	Owner   string
+	Balance float64
+	Limits  struct{ Daily, Monthly int }
+	secret  string
+	version int
+}
+
+func (a *account) bump() { a.version++ }
+
+func main() {
+	a := account{ID: 7, Owner: "ana", Balance: 12.5, secret: "pin"}
+	a.Limits.Daily = 100
+	a.bump()
+	out, err := json.Marshal(a)
+	fmt.Println(string(out), err)
+
+	var back account
+	err = json.Unmarshal([]byte("{\"ID\":8,\"Owner\":\"bo\",\"Limits\":{\"Monthly\":900}}"), &back)
+	fmt.Println(back.ID, back.Owner, back.Limits.Monthly, err)
+
+	t := reflect.TypeOf(a)
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.IsExported() {
+			fmt.Println(f.Name)
+		}
+	}
+	fmt.Println(a.secret, a.version)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type key struct{}
+
+func lookup(ctx context.Context) string {
+	if v, ok := ctx.Value(key{}).(string); ok {
+		return strings.ToUpper(v)
+	}
+	return "none"
+}
+
+// Linters key on testing.T and context.Context spelled out
+func check(t *testing.T, ctx context.Context) {
+	if lookup(ctx) == "" {
+		t.Fatal("empty")
+	}
+}
+
+func main() {
+	ctx := context.WithValue(context.Background(), key{}, "request")
+	fmt.Println(lookup(ctx), lookup(context.TODO()))
+	fmt.Println(testing.Testing(), check != nil)
+}
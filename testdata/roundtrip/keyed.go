@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+type User struct {
+	Name string
+	Age  int
+}
+
+type Box[T any] struct {
+	Val T
+}
+
+func main() {
+	u := User{Name: "x", Age: 1}
+	ptrs := []*User{{Name: "p", Age: 2}}
+	byUser := map[User]string{{Name: "k"}: "v"}
+	ages := map[string]int{"Name": 3}
+	b := Box[int]{Val: 4}
+	anon := struct{ Name string }{Name: "anon"}
+	fmt.Println(u.Name, u.Age, ptrs[0].Name, byUser[User{Name: "k"}], ages["Name"], b.Val, anon.Name)
+}
@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+func search(grid [][]int, target int) (int, int) {
+	row, col := -1, -1
+Outer:
+	for i, r := range grid {
+		for j, v := range r {
+			if v < 0 {
+				continue Outer
+			}
+			if v == target {
+				row, col = i, j
+				break Outer
+			}
+		}
+	}
+	return row, col
+}
+
+func countdown(n int) int {
+	steps := 0
+Loop:
+	if n > 0 {
+		n--
+		steps++
+		goto Loop
+	}
+	return steps
+}
+
+func main() {
+	grid := [][]int{{1, 2}, {-1, 9}, {3, 42}}
+	fmt.Println(search(grid, 42))
+	fmt.Println(countdown(15))
+}
@@ -0,0 +1,48 @@
+// Package main checks that -garble-comments keeps every line where it was:
+// the program prints the line numbers it runs at, and they must not move.
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+/*
+where reports the caller's line.
+
+It is called from several places below.
+*/
+func where() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line
+}
+
+// step is kept out of line so its frame shows up.
+//
+//go:noinline
+func step(n int) int {
+	// a comment with "quotes" and a ` backtick
+	return n * 42 /* inline */
+}
+
+func main() {
+	fmt.Println("first", where()) // trailing comment
+
+	// two lines
+	// of comments
+	total := 0
+	for i := 0; i < 12; i++ {
+		total += step(i)
+	}
+	fmt.Println("total", total, where())
+
+	fmt.Println("last", /* block */ where())
+}
+
+func init() {
+	// a multi-line raw string keeps its line breaks too
+	query := `SELECT name
+FROM users
+WHERE id = ?`
+	fmt.Println(len(query), where())
+}
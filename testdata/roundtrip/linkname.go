@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	_ "unsafe"
+)
+
+// nanotime reads the runtime's monotonic clock.
+//
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+func where() string {
+	_, file, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
+
+func main() {
+	start := nanotime()
+	total := 0
+	for i := 0; i < 12; i++ {
+		total += i
+	}
+//line generated.tmpl:100
+	fmt.Println(total, nanotime() >= start, where())
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+// Quotes and backticks inside other literals are not delimiters: the empty
+// raw string must not pair with the backtick of the script, and the quotes
+// in the rune and the raw strings must not start a string.
+var empty = ``
+
+var script = `function greet(name) { return "hello " + name; }`
+
+func main() {
+	quote, tick := '"', '`'
+	fmt.Println(len(empty), string(quote), string(tick), "mixed \" and ` inside")
+	fmt.Println(`a "short" one`, script)
+	fmt.Printf("%c%s%c\n", quote, "quoted text", quote)
+}
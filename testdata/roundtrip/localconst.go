@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type color string
+
+func describe() string {
+	const (
+		red   color = "crimson red"
+		prefix      = "colour: "
+	)
+	const label = prefix + "named"
+	return label + " " + string(red)
+}
+
+func main() {
+	const limit = 50
+	const size = limit / 10
+	var buf [size * 2]int
+	const delay = 25
+	start := time.Now()
+	time.Sleep(delay * time.Millisecond)
+	fmt.Println(len(buf), limit, time.Since(start) >= delay*time.Millisecond)
+
+	const (
+		low = iota * 100
+		mid
+		high
+	)
+	fmt.Println(low, mid, high)
+
+	const query = `SELECT name FROM users WHERE id = ?`
+	var q [len(query)]byte
+	fmt.Println(query, len(q))
+
+	const ratio = 3 / 2.0
+	fmt.Println(ratio, describe())
+	fmt.Printf("%s has %d items\n", "basket of fruit", limit)
+}
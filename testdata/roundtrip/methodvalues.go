@@ -0,0 +1,57 @@
+package main
+
+import "fmt"
+
+type job struct {
+	// Fields named like methods of worker
+	run  func(int) int
+	name string
+}
+
+type worker struct{ base int }
+
+func (w worker) run(n int) int { return w.base + n }
+
+func (w *worker) name() string { return fmt.Sprint("worker", w.base) }
+
+func (w *worker) add(n int) { w.base += n }
+
+func apply(f func(int) int, xs []int) (out []int) {
+	for _, x := range xs {
+		out = append(out, f(x))
+	}
+	return
+}
+
+func triple(n int) int { return n * 3 }
+
+func each(f func(int), xs ...int) {
+	for _, x := range xs {
+		f(x)
+	}
+}
+
+func main() {
+	w := &worker{base: 100}
+
+	// Method values passed around without being called
+	each(w.add, 1, 2, 3)
+	j := job{run: w.run, name: "keyed"}
+	fmt.Println(apply(j.run, []int{1, 2}), j.name)
+	namer := w.name
+	fmt.Println(namer())
+
+	// A plain function as a value
+	scale := triple
+	fmt.Println(apply(triple, []int{4}), scale(5), triple != nil)
+
+	// Method expressions
+	run := worker.run
+	name := (*worker).name
+	fmt.Println(run(*w, 7), name(w))
+
+	j2 := job{w.run, "positional"}
+	fmt.Println(j2.run(5), j2.name)
+	fns := map[string]func() string{"name": w.name}
+	fmt.Println(fns["name"]())
+}
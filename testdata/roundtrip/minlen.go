@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+// Run with -min-string-len 5 -min-backtick-len 25: each group holds a string
+// one shorter than the limit, one at it and one over it
+func main() {
+	fmt.Println("abcd", "abcde", "abcdef")
+	fmt.Println(`function a() { xy = 1; }`)
+	fmt.Println(`function a() { xyz = 1; }`)
+	fmt.Println(`function a() { xyzw = 1; }`)
+}
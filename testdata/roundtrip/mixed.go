@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	s := fmt.Sprintf("order %d of %d", 4242, 9000)
+	label := "room 1234" + fmt.Sprint(5678)
+	fmt.Println(s, label, len("count 777"), 31337)
+}
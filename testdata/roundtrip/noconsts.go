@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type level int
+
+type mode string
+
+const (
+	debug level = iota
+	info
+	warning
+)
+
+const (
+	fast mode = "fast mode selected"
+	safe mode = "safe mode selected"
+)
+
+const bufferSize = 64
+
+const timeout = 30
+
+var names = [...]string{debug: "debug", info: "info", warning: "warning"}
+
+func pick(m mode) string {
+	return string(m)
+}
+
+func main() {
+	var buf [bufferSize]byte
+	fmt.Println(len(buf), names[warning], info)
+	fmt.Println(pick(fast), pick(safe))
+	wait := timeout * time.Second
+	fmt.Println(wait)
+}
@@ -0,0 +1,19 @@
+package main
+
+import "fmt"
+
+var banner = "public banner text"
+
+func secret() string {
+	key := "super-secret-key"
+	return fmt.Sprintf("%s:%d", key, 4242)
+}
+
+func public() string {
+	script := `function run() { return 1234; }`
+	return "visible string " + fmt.Sprint(5555) + script
+}
+
+func main() {
+	fmt.Println(banner, secret(), public())
+}
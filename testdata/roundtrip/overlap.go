@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+type Item struct {
+	Label string
+}
+
+type Cart struct {
+	Item  Item
+	Items []Item
+	Count int
+}
+
+type Count int
+
+type Entry struct{ Label string }
+
+type Wrapper struct {
+	*Entry
+	Note string
+}
+
+func main() {
+	c := Cart{Item: Item{Label: "first"}, Items: []Item{{Label: "a"}, {Label: "b"}}, Count: 2}
+	w := Wrapper{Entry: &Entry{Label: "wrapped"}, Note: "n"}
+	var n Count = Count(c.Count)
+	fmt.Println(c.Item.Label, len(c.Items), c.Count, w.Entry.Label, w.Label, n)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "fmt"
+
+func f(count int) (total int) {
+	total = count
+	return
+}
+
+func split(sum int) (x, y int) {
+	x = sum * 4 / 9
+	y = sum - x
+	return
+}
+
+func apply(fn func(value int) (result int), in int) (out int) {
+	out = fn(in)
+	return
+}
+
+type Acc struct{ N int }
+
+func (a *Acc) Add(delta int) (next int) {
+	a.N += delta
+	next = a.N
+	return
+}
+
+func main() {
+	a := &Acc{}
+	a.Add(3)
+	fmt.Println(f(7), apply(func(v int) (r int) { r = v * 2; return }, 21), a.Add(4))
+	fmt.Println(split(17))
+}
+
+type Label struct {
+	Name  string
+	Value int
+}
+
+func makeLabel(Name string, Value int) Label {
+	tags := map[string]int{Name: Value}
+	return Label{Name: Name, Value: tags[Name]}
+}
+
+func init() {
+	l := makeLabel("lbl", 9)
+	fmt.Println(l.Name, l.Value)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Only the crypto side matches -func-pattern and -type-pattern
+type cryptoKey struct{ shift int }
+
+type cryptoMode int
+
+type config struct {
+	key  cryptoKey
+	mode cryptoMode
+}
+
+func (k cryptoKey) cryptoApply(s string, sign int) string {
+	return strings.Map(func(r rune) rune { return r + rune(sign*k.shift) }, s)
+}
+
+func cryptoEncrypt(k cryptoKey, s string) string { return k.cryptoApply(s, 1) }
+
+func cryptoDecrypt(k cryptoKey, s string) string { return k.cryptoApply(s, -1) }
+
+func (c config) describe() string { return fmt.Sprintf("shift %d, mode %d", c.key.shift, c.mode) }
+
+func roundTrip(c config, s string, codec func(cryptoKey, string) string) string {
+	return cryptoDecrypt(c.key, codec(c.key, s))
+}
+
+func main() {
+	c := config{key: cryptoKey{shift: 3}, mode: cryptoMode(2)}
+	secret := cryptoEncrypt(c.key, "hello")
+	fmt.Println(secret, cryptoDecrypt(c.key, secret))
+	fmt.Println(c.describe(), roundTrip(c, "abc", cryptoEncrypt))
+}
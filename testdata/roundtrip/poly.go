@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var greeting = "hello, poly"
+
+var limits = []int{7, 42, 1000, -3, 65535}
+
+const query = "SELECT id FROM users WHERE name = ?"
+
+func label(n int) string {
+	switch {
+	case n < 0:
+		return "negative"
+	case n > 100:
+		return "large"
+	}
+	return "small"
+}
+
+func main() {
+	fmt.Println(greeting)
+	total := 0
+	for _, n := range limits {
+		total += n
+		fmt.Printf("%6d %s\n", n, label(n))
+	}
+	fmt.Println("total:", total, total%97, 1<<10)
+	words := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta", "theta"}
+	fmt.Println(strings.Join(words, "-"), len(words))
+	fmt.Println(query)
+	fmt.Println(`raw
+multi-line text`)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Reader struct {
+	Pos int
+}
+
+type Base struct {
+	Level int
+}
+
+func (b *Base) Bump() { b.Level++ }
+
+type Stream struct {
+	io.Reader
+	*Base
+	Local Reader
+}
+
+func main() {
+	s := Stream{Reader: strings.NewReader("data"), Base: &Base{Level: 1}, Local: Reader{Pos: 3}}
+	s.Bump()
+	buf := make([]byte, 4)
+	n, _ := s.Reader.Read(buf)
+	fmt.Println(n, string(buf), s.Level, s.Base.Level, s.Local.Pos)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Shaped like protoc-gen-go output that was copied and edited by hand: the
+// protobuf runtime finds fields and methods by name, so they must survive
+type messageState struct{ atomicMessageInfo int }
+
+type Greeting struct {
+	state         messageState
+	sizeCache     int32
+	unknownFields []byte
+
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Count int32  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+func (x *Greeting) Reset()               { *x = Greeting{} }
+func (*Greeting) ProtoMessage()          {}
+func (x *Greeting) ProtoReflect() string { return "greeting" }
+
+func (x *Greeting) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// tagged only: found by its protobuf tags
+type Reply_Text struct {
+	Text string `protobuf:"bytes,3,opt,name=text,proto3,oneof"`
+}
+
+// embeds a message, so its method set has ProtoReflect
+type annotated struct {
+	*Greeting
+	note string
+}
+
+func (a annotated) Describe() string { return a.note + ": " + a.GetName() }
+
+// not protobuf: free to rename
+type plain struct {
+	label string
+}
+
+func (p plain) Label() string { return p.label }
+
+func names(v interface{}) string {
+	t := reflect.TypeOf(v)
+	var parts []string
+	for i := 0; i < t.NumMethod(); i++ {
+		parts = append(parts, t.Method(i).Name)
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// embedded fields are named after their type, which may be renamed
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).Anonymous {
+			parts = append(parts, t.Field(i).Name)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func main() {
+	g := &Greeting{Name: "hello", Count: 2}
+	fmt.Println(names(g))
+	fmt.Println(names(Reply_Text{}))
+	fmt.Println(names(annotated{Greeting: g, note: "first"}))
+	fmt.Println(annotated{Greeting: g, note: "first"}.Describe(), g.ProtoReflect())
+	fmt.Println(plain{label: "x"}.Label())
+}
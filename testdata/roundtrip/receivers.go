@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type counter struct {
+	name  string
+	count int
+	// A field named like the receiver of the methods below
+	c int
+}
+
+// The receiver is renamed in every use, though a field shares its name
+func (c *counter) add(n int) {
+	c.count += n
+	c.c++
+	if c.count > 10 {
+		c.name = strings.ToUpper(c.name)
+	}
+}
+
+func (c counter) String() string {
+	copy := counter{c: c.c, name: c.name}
+	return fmt.Sprintf("%s=%d (%d adds, copy %s/%d)", c.name, c.count, c.c, copy.name, copy.c)
+}
+
+type pair struct{ left, right int }
+
+// Value receivers can be reassigned without touching the caller's copy
+func (p pair) swapped() pair {
+	p.left, p.right = p.right, p.left
+	return p
+}
+
+// Unnamed and blank receivers stay as they are
+func (pair) kind() string { return "pair" }
+
+func (_ *counter) kind() string { return "counter" }
+
+func main() {
+	c := &counter{name: "hits"}
+	for i := 1; i <= 5; i++ {
+		c.add(i)
+	}
+	fmt.Println(c)
+	p := pair{1, 2}
+	fmt.Println(p.swapped(), p, p.kind(), c.kind())
+}
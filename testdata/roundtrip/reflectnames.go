@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type Config struct {
+	Host    string
+	Port    int
+	Retries int
+	Timeout int
+}
+
+func (c Config) Describe() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+func (c Config) Address() string {
+	return c.Host
+}
+
+func main() {
+	c := Config{Host: "example.org", Port: 8080, Retries: 3, Timeout: 30}
+	v := reflect.ValueOf(c)
+	fmt.Println(v.FieldByName("Host"), v.FieldByName("Port"))
+	if f, ok := reflect.TypeOf(c).FieldByName("Retries"); ok {
+		fmt.Println(f.Name, v.FieldByIndex(f.Index))
+	}
+	timeout := v.FieldByNameFunc(func(name string) bool {
+		return name == "Timeout"
+	})
+	fmt.Println(timeout.IsValid())
+	out := v.MethodByName("Describe").Call(nil)
+	fmt.Println(out[0], c.Address())
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Values bound by comm clauses are renamed with their uses, and channels like
+// any other variable.
+func main() {
+	values := make(chan int, 1)
+	names := make(chan string, 1)
+	done := make(chan struct{})
+	values <- 21
+	for round := 0; round < 3; round++ {
+		select {
+		case value := <-values:
+			fmt.Println("value", value*2)
+			names <- fmt.Sprint("n", value)
+		case name, ok := <-names:
+			fmt.Println("name", name, ok)
+			close(done)
+		case <-done:
+			fmt.Println("done")
+		case <-time.After(time.Second):
+			fmt.Println("timeout")
+		}
+	}
+	// Both clauses bind the same name, shadowing the outer one
+	value := "outer"
+	values <- 5
+	select {
+	case value := <-values:
+		fmt.Println("inner", value+1)
+	case value := <-names:
+		fmt.Println("inner", value)
+	}
+	fmt.Println(value)
+
+	var last int
+	select {
+	case last = <-values:
+	default:
+		last = -1
+	}
+	fmt.Println(last)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "fmt"
+
+type User struct {
+	Name string
+}
+
+type Score int
+
+func greet(User string) string {
+	return "hi " + User
+}
+
+func total(Score []int) Score {
+	sum := 0
+	for _, s := range Score {
+		sum += s
+	}
+	return 0 + 1*2 - 2 + sumOf(sum)
+}
+
+func sumOf(n int) Score {
+	return Score(n)
+}
+
+func main() {
+	var user User = User{Name: "ann"}
+	users := []User{user, {Name: "bob"}}
+	fmt.Println(greet(user.Name), len(users), total([]int{1, 2, 3}), Score(4))
+}
@@ -0,0 +1,42 @@
+package main
+
+import "fmt"
+
+// min hides the builtin in the whole package
+func min(values []int) int {
+	lowest := values[0]
+	for _, v := range values[1:] {
+		if v < lowest {
+			lowest = v
+		}
+	}
+	return lowest
+}
+
+func total(values []int) int {
+	max := 0
+	for _, v := range values {
+		max += v
+	}
+	return max
+}
+
+func pending(tasks map[string]bool) int {
+	clear := 0
+	for _, done := range tasks {
+		if !done {
+			clear++
+		}
+	}
+	return clear
+}
+
+func main() {
+	values := []int{5, 3, 9}
+	pick := min
+	fmt.Println(min(values), pick(values[1:]), total(values), max(4, 7))
+	tasks := map[string]bool{"build": true, "test": false}
+	fmt.Println(pending(tasks))
+	clear(tasks)
+	fmt.Println(len(tasks))
+}
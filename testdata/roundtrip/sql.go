@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	q := `SELECT id, name FROM users
+WHERE id = $1 AND tag = ? AND x = '{{.Table}}'`
+	fmt.Println(q)
+	fmt.Println("plain message here", 1234)
+	fmt.Printf("value %d and %s\n", 42, "zzz")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var calls []string
+
+// trace records the order expressions are evaluated in
+func trace(name string, v int) int {
+	calls = append(calls, name)
+	return v
+}
+
+func classify(n int) string {
+	switch n {
+	case 0:
+		return "zero"
+	case 1, 2, 3:
+		return "small"
+	case 42:
+		return "answer"
+	}
+	return "other"
+}
+
+func grade(score int) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 75 && score < 90:
+		return "B"
+	default:
+		return "C"
+	}
+}
+
+// fall runs every clause from the matching one down to the first without
+// fallthrough; default sits in the middle.
+func fall(n int) []string {
+	var out []string
+	switch n {
+	case 1:
+		out = append(out, "one")
+		fallthrough
+	case 2:
+		out = append(out, "two")
+	default:
+		out = append(out, "default")
+		fallthrough
+	case 3:
+		out = append(out, "three")
+		fallthrough
+	case 4:
+		out = append(out, "four")
+	}
+	return out
+}
+
+// sign ends in a switch with default and fallthrough: every clause returns
+// or falls through, so no return is needed after it.
+func sign(n int) string {
+	switch {
+	case n < 0:
+		return "negative"
+	case n == 0:
+		fallthrough
+	default:
+		if n == 0 {
+			return "not positive"
+		} else {
+			return "positive"
+		}
+	}
+}
+
+func describe(err error) string {
+	switch err {
+	case nil:
+		return "ok"
+	case errNotFound:
+		return "missing"
+	}
+	return "failed: " + err.Error()
+}
+
+var errNotFound = errors.New("not found")
+
+func main() {
+	for _, n := range []int{0, 2, 42, 7} {
+		fmt.Println(n, classify(n))
+	}
+	fmt.Println(grade(95), grade(80), grade(10))
+	for n := 1; n <= 5; n++ {
+		fmt.Println(n, fall(n))
+	}
+	fmt.Println(sign(-1), sign(0), sign(1))
+	fmt.Println(describe(nil), describe(errNotFound), describe(errors.New("boom")))
+
+	// The tag is evaluated once, cases in order until one matches
+	switch trace("tag", 2) {
+	case trace("a", 1), trace("b", 2), trace("c", 3):
+		fmt.Println("matched b")
+	case trace("d", 2):
+		fmt.Println("unreachable")
+	}
+	fmt.Println(calls)
+
+	// Init statements stay scoped to the switch
+	switch x := len(calls) * 2; {
+	case x > 5:
+		fmt.Println("many calls", x)
+	}
+
+	// A break of its own keeps the switch as it is; the break in the loop
+	// belongs to the loop
+	for i := 0; i < 3; i++ {
+		switch i {
+		case 1:
+			if i > 0 {
+				break
+			}
+			fmt.Println("not printed")
+		default:
+			for {
+				break
+			}
+			fmt.Println("loop", i)
+		}
+	}
+
+	// Nested switches, and switches without cases
+	kind := "word"
+	switch len(kind) {
+	case 4:
+		switch kind {
+		case "word":
+			fmt.Println("nested")
+		}
+	}
+	switch trace("empty", 0) {
+	}
+	switch {
+	default:
+		fmt.Println("only default")
+	}
+	fmt.Println(len(calls))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Package-level values read the table before main runs
+var defaultColor = "crimson"
+
+var palette = []string{"crimson", "teal", "amber", "crimson", "indigo"}
+
+func describe(name string) string {
+	switch {
+	case strings.HasPrefix(name, "cri"):
+		return "red-ish " + name
+	case name == "teal":
+		return "blue-green"
+	}
+	return "other color"
+}
+
+func main() {
+	counts := map[string]int{}
+	for _, c := range palette {
+		counts[c]++
+	}
+	fmt.Println(defaultColor, counts["crimson"], counts["teal"], len(counts))
+	for _, c := range palette {
+		fmt.Printf("%-8s %s\n", c, describe(c))
+	}
+	fmt.Println(strings.Repeat("-", 4) + " done " + strings.Repeat("-", 4))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Account struct {
+	Owner   string   `json:"owner"`
+	Balance int      `json:"balance,omitempty"`
+	Labels  []string `json:"labels" xml:"label"`
+	secret  string
+}
+
+const script = `function greet(name) { return "hi " + name; }`
+
+const query = `SELECT id, owner FROM accounts WHERE balance > 100`
+
+func main() {
+	account := Account{Owner: "ada", Balance: 1200, Labels: []string{"vip"}, secret: "hidden value"}
+	data, _ := json.Marshal(account)
+	fmt.Println(string(data), len(account.secret))
+	fmt.Println(script)
+	fmt.Println(query, "`quoted`")
+}
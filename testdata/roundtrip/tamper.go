@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type level string
+
+const (
+	banner         = "tamper-checked build"
+	minimum  level = "info"
+	attempts       = 3
+)
+
+const license = `ACME-1234`
+
+// onTamper runs instead of the default exit when the check fails.
+func onTamper() {
+	fmt.Println("modified")
+	os.Exit(3)
+}
+
+func main() {
+	fmt.Println(banner, minimum, attempts, license)
+}
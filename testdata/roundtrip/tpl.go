@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+func main() {
+	t := `{{range .Items}}<li>{{if .Done}}return {{.Name}}{{end}}</li>{{end}}`
+	fmt.Println(t)
+}
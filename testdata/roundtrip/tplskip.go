@@ -0,0 +1,24 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"strings"
+	texttemplate "text/template"
+)
+
+type item struct {
+	Name string
+	Done bool
+}
+
+func main() {
+	title := texttemplate.Must(texttemplate.New("title").Parse("Report for {{.}} ready"))
+	title.Execute(os.Stdout, "alice")
+	os.Stdout.WriteString("\n")
+
+	var sb strings.Builder
+	list := template.Must(template.New("list").Parse(`<script>var x = 1;</script><ul>{{range .}}<li>{{if .Done}}done: {{end}}{{.Name}}</li>{{end}}</ul>`))
+	list.Execute(&sb, []item{{"write", true}, {"test", false}})
+	os.Stdout.WriteString(sb.String() + "\n")
+}
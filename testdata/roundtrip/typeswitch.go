@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Circle struct{ R int }
+type Square struct{ S int }
+type Reader struct{ N int }
+
+func describe(x interface{}) string {
+	switch v := x.(type) {
+	case Circle:
+		return fmt.Sprintf("circle %d", v.R)
+	case *Square:
+		return fmt.Sprintf("square %d", v.S)
+	case Reader:
+		return fmt.Sprintf("local reader %d", v.N)
+	case io.Reader:
+		return "reader"
+	case nil:
+		return "nil"
+	default:
+		_ = v
+		return "unknown"
+	}
+}
+
+func main() {
+	var s interface{} = Circle{R: 2}
+	if c, ok := s.(Circle); ok {
+		fmt.Println("is circle", c.R)
+	}
+	_, isReader := interface{}(strings.NewReader("x")).(io.Reader)
+	fmt.Println(describe(Circle{R: 1}), describe(&Square{S: 3}), describe(Reader{N: 4}), describe(strings.NewReader("abc")), describe(nil), describe(5), isReader)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A local type named like the imported bytes.Buffer
+type Buffer struct{ data []string }
+
+func (b *Buffer) Len() int { return len(b.data) }
+
+var v = "package v"
+
+// The binding is named like a field, is bound to a different type in each
+// clause and shadows nothing outside the switch
+func size(x interface{}) string {
+	switch data := x.(type) {
+	case *bytes.Buffer:
+		return fmt.Sprintf("bytes.Buffer %d", data.Len())
+	case *Buffer:
+		return fmt.Sprintf("Buffer %d", data.Len())
+	case *strings.Builder, fmt.Stringer:
+		return fmt.Sprintf("%T", data)
+	case []*Buffer:
+		n := 0
+		for _, b := range data {
+			n += b.Len()
+		}
+		return fmt.Sprint("buffers ", n)
+	default:
+		switch v := data.(type) {
+		case int:
+			return fmt.Sprint("int ", v+1)
+		}
+		return data.(string)
+	}
+}
+
+func main() {
+	fmt.Println(size(bytes.NewBufferString("abc")), size(&Buffer{data: []string{"a"}}), size(&strings.Builder{}))
+	fmt.Println(size([]*Buffer{{data: []string{"a", "b"}}, {}}), size(41), size("s"), v)
+}
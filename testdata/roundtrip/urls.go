@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func endpoint(path string) string {
+	return strings.TrimSuffix("https://api.example.com/v1/", "/") + path
+}
+
+func main() {
+	fmt.Println(endpoint("/users"), strings.HasPrefix("ftp://files.example.com", "ftp"))
+	fmt.Println("keep me readable", "and obfuscate me")
+}